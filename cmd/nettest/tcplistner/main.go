@@ -7,8 +7,10 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"os"
 
 	"github.com/shubh-man007/TinyProto/internal/request"
 )
@@ -38,7 +40,8 @@ func handleConn(conn net.Conn) {
 	}
 
 	fmt.Printf("Body:\n")
-	fmt.Printf("%s\n", string(r.Body))
+	io.Copy(os.Stdout, r.Body)
+	fmt.Println()
 }
 
 func main() {
@@ -1,25 +1,32 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
-	"strings"
 	"syscall"
+	"time"
 
+	"github.com/shubh-man007/TinyProto/internal/client"
+	"github.com/shubh-man007/TinyProto/internal/headers"
+	"github.com/shubh-man007/TinyProto/internal/middleware"
+	"github.com/shubh-man007/TinyProto/internal/proxy"
 	"github.com/shubh-man007/TinyProto/internal/request"
 	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/shubh-man007/TinyProto/internal/router"
 	"github.com/shubh-man007/TinyProto/internal/server"
 )
 
 const port = 8080
-const CRLF = "\r\n"
+const shutdownTimeout = 10 * time.Second
+
+var httpbin = &client.Client{Timeout: 30 * time.Second}
 
 // Client template:
 const res400 = `<html>
@@ -52,116 +59,8 @@ const res200 = `<html>
   </body>
 </html>`
 
-func RequestPath(w *response.Writer, req *request.Request) {
-	path := req.RequestLine.RequestTarget
-	h := response.GetDefaultHeaders(0)
-
-	body := []byte(res200)
-	stat := response.StatusOK
-
-	if path == "/yourproblem" {
-		body = []byte(res400)
-		stat = response.StatusBadRequest
-	} else if path == "/myproblem" {
-		body = []byte(res500)
-		stat = response.StatusInternalServerError
-	} else if path == "/video" {
-		file, err := os.Open("assets/clouds.mp4") // Set file name accordingly.
-		if err != nil {
-			body = []byte(res500)
-			stat = response.StatusInternalServerError
-		}
-		defer file.Close()
-
-		info, err := file.Stat()
-		if err != nil {
-			body = []byte(res500)
-			stat = response.StatusInternalServerError
-		}
-
-		h := response.GetDefaultHeaders(int(info.Size()))
-		h.Replace("Content-Type", "video/mp4")
-
-		w.WriteStatusLine(response.StatusOK)
-		w.WriteHeaders(h)
-
-		buffer := make([]byte, 32*1024) // 32KB chunks
-		for {
-			n, err := file.Read(buffer)
-			if n > 0 {
-				w.WriteBody(buffer[:n])
-			}
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				body = []byte(res500)
-				stat = response.StatusInternalServerError
-			}
-		}
-	} else if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin/stream") {
-		target := req.RequestLine.RequestTarget
-		res, err := http.Get("https://httpbin.org" + strings.TrimPrefix(target, "/httpbin"))
-		if err != nil {
-			body = []byte(res500)
-			stat = response.StatusInternalServerError
-		} else {
-			w.WriteStatusLine(response.StatusOK)
-
-			h.Delete("Content-Length")
-			h.Set("transfer-encoding", "chunked")
-			h.Replace("Content-Type", "text/plain")
-			h.Set("Trailer", "X-Content-SHA256")
-			h.Set("Trailer", "X-Content-Length")
-
-			w.WriteHeaders(h)
-			w.WriteTrailers(h)
-
-			var fullBody []byte
-
-			fmt.Printf(">> Proxy Response: \n")
-			for {
-				data := make([]byte, 32)
-				n, err := res.Body.Read(data)
-				if err != nil {
-					break
-				}
-				w.WriteBody([]byte(fmt.Sprintf("%x%s", n, CRLF)))
-				w.WriteBody(data[:n])
-				w.WriteBody([]byte(CRLF))
-
-				fullBody = append(fullBody, data[:n]...)
-
-				log.Printf("\n%s\n", string(data[:n]))
-			}
-			w.WriteBody([]byte(fmt.Sprintf("0%s%s", CRLF, CRLF)))
-
-			hash := sha256.Sum256(fullBody)
-			h.Set("X-Content-SHA256", hex.EncodeToString(hash[:]))
-			h.Set("X-Content-Length", strconv.Itoa(len(fullBody)))
-
-			w.WriteTrailers(h)
-
-			log.Println("\n-----------------")
-			return
-		}
-	}
-
-	// switch path {
-	// case "/yourproblem":
-	// 	body = []byte(res400)
-	// 	stat = response.StatusBadRequest
-
-	// case "/myproblem":
-	// 	body = []byte(res500)
-	// 	stat = response.StatusInternalServerError
-
-	// default:
-	// 	body = []byte(res200)
-	// 	stat = response.StatusOK
-	// }
-
-	h.Replace("Content-Length", strconv.Itoa(len(body)))
+func writeHTML(w *response.Writer, stat response.StatusCode, body []byte) {
+	h := response.GetDefaultHeaders(len(body))
 	h.Replace("Content-Type", "text/html")
 
 	if err := w.WriteStatusLine(stat); err != nil {
@@ -183,16 +82,144 @@ func RequestPath(w *response.Writer, req *request.Request) {
 	log.Printf("\nResponse: \n%s\n", res)
 }
 
+func YourProblem(w *response.Writer, req *request.Request) {
+	writeHTML(w, response.StatusBadRequest, []byte(res400))
+}
+
+func MyProblem(w *response.Writer, req *request.Request) {
+	writeHTML(w, response.StatusInternalServerError, []byte(res500))
+}
+
+func Index(w *response.Writer, req *request.Request) {
+	writeHTML(w, response.StatusOK, []byte(res200))
+}
+
+func Video(w *response.Writer, req *request.Request) {
+	file, err := os.Open("assets/clouds.mp4") // Set file name accordingly.
+	if err != nil {
+		writeHTML(w, response.StatusInternalServerError, []byte(res500))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		writeHTML(w, response.StatusInternalServerError, []byte(res500))
+		return
+	}
+
+	h := response.GetDefaultHeaders(int(info.Size()))
+	h.Replace("Content-Type", "video/mp4")
+
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(h)
+
+	buffer := make([]byte, 32*1024) // 32KB chunks
+	for {
+		n, err := file.Read(buffer)
+		if n > 0 {
+			w.WriteBody(buffer[:n])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Error reading video: %v", err)
+			return
+		}
+	}
+}
+
+func HTTPBinStream(w *response.Writer, req *request.Request) {
+	url := "https://httpbin.org/stream/" + req.PathValue("rest")
+	if req.Target.RawQuery != "" {
+		url += "?" + req.Target.RawQuery
+	}
+	res, err := httpbin.Get(req.Context(), url)
+	if err != nil {
+		writeHTML(w, response.StatusInternalServerError, []byte(res500))
+		return
+	}
+	defer res.Body.Close()
+
+	w.WriteStatusLine(response.StatusOK)
+
+	h := response.GetDefaultHeaders(0)
+	h.Delete("Content-Length")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Replace("Content-Type", "text/plain")
+	h.Set("Trailer", "X-Content-SHA256")
+	h.Set("Trailer", "X-Content-Length")
+
+	w.WriteHeaders(h)
+
+	trailers := headers.NewHeaders()
+	cw := w.ChunkedWriter(trailers)
+	hash := sha256.New()
+	size := 0
+
+	fmt.Printf(">> Proxy Response: \n")
+	for {
+		data := make([]byte, 32)
+		n, err := res.Body.Read(data)
+		if n > 0 {
+			cw.Write(data[:n])
+			hash.Write(data[:n])
+			size += n
+
+			log.Printf("\n%s\n", string(data[:n]))
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	trailers.Set("X-Content-SHA256", hex.EncodeToString(hash.Sum(nil)))
+	trailers.Set("X-Content-Length", strconv.Itoa(size))
+
+	if err := cw.Close(); err != nil {
+		log.Printf("Error writing trailers: %v", err)
+	}
+
+	log.Println("\n-----------------")
+}
+
+func routes() *router.Router {
+	// The rest of httpbin.org is passed through as it is.
+	httpbinProxy, err := proxy.New("https://httpbin.org")
+	if err != nil {
+		log.Fatalf("Error creating httpbin proxy: %v", err)
+	}
+	httpbinProxy.Rewrite = proxy.StripPrefix("/httpbin")
+	httpbinProxy.Timeout = 30 * time.Second
+
+	rt := router.New()
+	rt.Handle("", "/yourproblem", YourProblem)
+	rt.Handle("", "/myproblem", MyProblem)
+	rt.Handle("", "/video", Video)
+	rt.Handle("", "/httpbin/stream/{rest...}", HTTPBinStream)
+	rt.Handle("", "/httpbin/{rest...}", httpbinProxy.Serve)
+	rt.Handle("", "/{path...}", Index)
+	return rt
+}
+
 func main() {
-	server, err := server.Serve(port, RequestPath)
+	server, err := server.Serve(port, middleware.Chain(routes().Serve, middleware.Logger, middleware.Recover))
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	forced, err := server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("Shutdown timed out, %d connection(s) forcibly closed", forced)
+		return
+	}
 	log.Println("\nServer gracefully stopped")
 }
@@ -0,0 +1,520 @@
+// Package client sends requests over HTTP/1.1 with the same wire code the
+// server uses, keeping connections alive between requests to the same host.
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+)
+
+const (
+	DefaultMaxIdleConnsPerHost = 2
+	DefaultIdleConnTimeout     = 90 * time.Second
+	DefaultMaxRedirects        = 10
+)
+
+// maxRedirectDrain is how much of a redirect's body is read to keep its
+// connection for the next hop.
+const maxRedirectDrain = 4 << 10
+
+var (
+	ErrTooManyRedirects = errors.New("error: stopped after too many redirects")
+	// ErrUseLastResponse is returned by a RedirectPolicy to stop following
+	// redirects and hand the redirect response itself to the caller.
+	ErrUseLastResponse = errors.New("error: use last response")
+
+	errBodyClosed = errors.New("error: read on closed response body")
+)
+
+// RedirectPolicy decides whether to follow a redirect to req. via holds the
+// requests made so far, oldest first. Returning ErrUseLastResponse makes Do
+// return the redirect response, any other error makes it fail with it.
+type RedirectPolicy func(req *request.Request, via []*request.Request) error
+
+// LimitRedirects follows up to n redirects in a row.
+func LimitRedirects(n int) RedirectPolicy {
+	return func(req *request.Request, via []*request.Request) error {
+		if len(via) > n {
+			return ErrTooManyRedirects
+		}
+		return nil
+	}
+}
+
+// NoRedirects returns every redirect response as it is.
+func NoRedirects(req *request.Request, via []*request.Request) error {
+	return ErrUseLastResponse
+}
+
+type Client struct {
+	// Timeout bounds a whole exchange, redirects and reading the body
+	// included, on top of the request's context. Zero means no limit.
+	Timeout time.Duration
+	// CheckRedirect is the redirect policy. Nil means
+	// LimitRedirects(DefaultMaxRedirects).
+	CheckRedirect RedirectPolicy
+	// MaxIdleConnsPerHost caps the idle connections kept per host. Zero
+	// means DefaultMaxIdleConnsPerHost, a negative value disables pooling.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept. Zero means
+	// DefaultIdleConnTimeout.
+	IdleConnTimeout time.Duration
+	// TLSConfig is used for https URLs. Nil means the defaults, verifying
+	// the server against the system roots.
+	TLSConfig *tls.Config
+	// DialContext opens connections. Nil means a net.Dialer.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	mu   sync.Mutex
+	idle map[string][]*conn
+}
+
+func NewClient() *Client {
+	return &Client{}
+}
+
+// conn is a connection to one host, pooled between exchanges.
+type conn struct {
+	key       string
+	nc        net.Conn
+	br        *bufio.Reader
+	reused    bool
+	idleTimer *time.Timer
+}
+
+// Get sends a GET request for url.
+func (c *Client) Get(ctx context.Context, url string) (*response.Response, error) {
+	req, err := request.NewRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends req, built with request.NewRequest or otherwise carrying an
+// absolute http or https target, and returns the response once its headers
+// have arrived, following redirects as CheckRedirect allows. The caller must
+// read Body to its end or close it, which releases the connection; one read
+// to its end goes back to the pool. req's context bounds the exchange,
+// reading the body included.
+func (c *Client) Do(req *request.Request) (*response.Response, error) {
+	if req.Target.Form != request.TargetAbsolute || (req.Target.Scheme != "http" && req.Target.Scheme != "https") {
+		return nil, fmt.Errorf("%w: %q", request.ErrInvalidURL, req.RequestLine.RequestTarget)
+	}
+
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		req = req.WithContext(ctx)
+	}
+	policy := c.CheckRedirect
+	if policy == nil {
+		policy = LimitRedirects(DefaultMaxRedirects)
+	}
+
+	var via []*request.Request
+	for {
+		res, err := c.roundTrip(req)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		next, err := redirectRequest(req, res)
+		if err == nil && next != nil {
+			via = append(via, req)
+			err = policy(next, via)
+		}
+		if next == nil || errors.Is(err, ErrUseLastResponse) {
+			res.Body.(*body).setCancel(cancel)
+			return res, nil
+		}
+
+		io.CopyN(io.Discard, res.Body, maxRedirectDrain)
+		res.Body.Close()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		req = next
+	}
+}
+
+// roundTrip sends req once and reads its final response, skipping interim
+// ones. A pooled connection the server closed while it sat idle fails before
+// any response arrives; the request is then sent again on a new connection,
+// if its body can be.
+func (c *Client) roundTrip(req *request.Request) (*response.Response, error) {
+	ctx := req.Context()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		pc, err := c.getConn(ctx, req.Target.Scheme, req.Target.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		res, stale, err := c.exchange(ctx, pc, req)
+		if err == nil {
+			return res, nil
+		}
+		if !stale || attempt > 0 || (hasBody(req) && req.GetBody == nil) {
+			return nil, err
+		}
+		if hasBody(req) {
+			rc, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r2 := *req
+			r2.Body = rc
+			req = &r2
+		}
+	}
+}
+
+// exchange writes req on pc and reads the response head. stale reports a
+// failure that means the pooled connection was dead before req was sent.
+func (c *Client) exchange(ctx context.Context, pc *conn, req *request.Request) (res *response.Response, stale bool, err error) {
+	stop := context.AfterFunc(ctx, func() {
+		// A deadline in the past unblocks pending reads and writes.
+		pc.nc.SetDeadline(time.Unix(1, 0))
+	})
+	fail := func(err error) (*response.Response, bool, error) {
+		stop()
+		pc.nc.Close()
+		if ctx.Err() != nil {
+			return nil, false, ctx.Err()
+		}
+		return nil, pc.reused && isStale(err), err
+	}
+
+	if err := req.Write(pc.nc); err != nil {
+		return fail(err)
+	}
+	for {
+		res, err = response.ReadResponse(pc.br, req.RequestLine.Method)
+		if err != nil {
+			return fail(err)
+		}
+		if res.StatusCode < 100 || res.StatusCode > 199 || res.StatusCode == response.StatusSwitchingProtocols {
+			break
+		}
+	}
+
+	reuse := !res.Close && req.KeepAlive()
+	b := &body{rc: res.Body, ctx: ctx, reuse: reuse}
+	b.release = func(reuse bool) {
+		// stop fails once the context fired and broke the connection.
+		if stop() && reuse {
+			c.putIdle(pc)
+			return
+		}
+		pc.nc.Close()
+	}
+	res.Body = b
+	if res.ContentLength == 0 {
+		b.finish(reuse)
+	}
+	return res, false, nil
+}
+
+// isStale reports whether err is what writing to or reading from a
+// connection closed by the server looks like.
+func isStale(err error) bool {
+	return err == io.EOF || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// hasBody reports whether req has a body to send.
+func hasBody(req *request.Request) bool {
+	if len(req.Header.Values("Transfer-Encoding")) > 0 {
+		return true
+	}
+	cl := req.Header.Get("Content-Length")
+	return cl != "" && cl != "0"
+}
+
+// redirectRequest builds the request following res, or returns nil if res
+// is not a redirect that can be followed. 301 and 302 turn a POST into a
+// GET, 303 turns anything but HEAD into a GET; 307 and 308 resend the body,
+// which needs req.GetBody. Credentials are dropped when the host changes.
+func redirectRequest(req *request.Request, res *response.Response) (*request.Request, error) {
+	code := res.StatusCode
+	switch code {
+	case response.StatusMovedPermanently, response.StatusFound, response.StatusSeeOther,
+		response.StatusTemporaryRedirect, response.StatusPermanentRedirect:
+	default:
+		return nil, nil
+	}
+	location := res.Header.Get("Location")
+	if location == "" {
+		return nil, nil
+	}
+
+	base, err := url.Parse(req.RequestLine.RequestTarget)
+	if err != nil {
+		return nil, nil
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return nil, nil
+	}
+	target := base.ResolveReference(ref)
+	target.Fragment = ""
+
+	method := req.RequestLine.Method
+	keepBody := true
+	if (code == response.StatusSeeOther && method != "HEAD") ||
+		((code == response.StatusMovedPermanently || code == response.StatusFound) && method == "POST") {
+		method = "GET"
+		keepBody = false
+	}
+	if keepBody && hasBody(req) && req.GetBody == nil {
+		return nil, nil
+	}
+
+	next, err := request.NewRequest(req.Context(), method, target.String(), nil)
+	if err != nil {
+		// A redirect elsewhere than http or https is left to the caller.
+		return nil, nil
+	}
+	sameHost := strings.EqualFold(next.Target.Host, req.Target.Host)
+	for key, value := range req.Header.Iter() {
+		switch strings.ToLower(key) {
+		case "host":
+			continue
+		case "content-length", "transfer-encoding", "content-type":
+			if !keepBody {
+				continue
+			}
+		case "authorization", "proxy-authorization", "cookie":
+			if !sameHost {
+				continue
+			}
+		}
+		next.Header.Add(key, value)
+	}
+	if keepBody && hasBody(req) {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = rc
+		next.GetBody = req.GetBody
+	}
+	return next, nil
+}
+
+// body releases the connection once the response body has been read to its
+// end or closed, and cancels the exchange's timeout with it.
+type body struct {
+	rc      io.ReadCloser
+	ctx     context.Context
+	reuse   bool
+	release func(reuse bool)
+	err     error
+
+	mu     sync.Mutex
+	done   bool
+	cancel context.CancelFunc
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.rc.Read(p)
+	if err != nil {
+		if err != io.EOF && b.ctx.Err() != nil {
+			err = b.ctx.Err()
+		}
+		b.err = err
+		b.finish(err == io.EOF && b.reuse)
+	}
+	return n, err
+}
+
+// Close gives up the connection unless the body was read to its end.
+func (b *body) Close() error {
+	if b.err == nil {
+		b.err = errBodyClosed
+	}
+	b.finish(false)
+	return nil
+}
+
+func (b *body) finish(reuse bool) {
+	b.mu.Lock()
+	first := !b.done
+	b.done = true
+	cancel := b.cancel
+	b.mu.Unlock()
+
+	if first {
+		b.release(reuse)
+	}
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// setCancel ties cancel to the end of the body, or calls it right away if
+// the body is already done.
+func (b *body) setCancel(cancel context.CancelFunc) {
+	b.mu.Lock()
+	b.cancel = cancel
+	done := b.done
+	b.mu.Unlock()
+
+	if done && b.err != nil {
+		cancel()
+	}
+}
+
+// getConn returns an idle connection to host, or dials a new one.
+func (c *Client) getConn(ctx context.Context, scheme, host string) (*conn, error) {
+	addr := hostAddr(scheme, host)
+	key := scheme + "://" + addr
+	if pc := c.takeIdle(key); pc != nil {
+		return pc, nil
+	}
+
+	dial := c.DialContext
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	nc, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if scheme == "https" {
+		config := &tls.Config{}
+		if c.TLSConfig != nil {
+			config = c.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		if len(config.NextProtos) == 0 {
+			config.NextProtos = []string{"http/1.1"}
+		}
+		tc := tls.Client(nc, config)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			nc.Close()
+			return nil, err
+		}
+		nc = tc
+	}
+
+	return &conn{key: key, nc: nc, br: bufio.NewReader(nc)}, nil
+}
+
+// hostAddr returns host with the default port of scheme if it has none.
+func hostAddr(scheme, host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	port := "80"
+	if scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+func (c *Client) takeIdle(key string) *conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for conns := c.idle[key]; len(conns) > 0; conns = c.idle[key] {
+		pc := conns[len(conns)-1]
+		c.idle[key] = conns[:len(conns)-1]
+		// A timer that already fired is closing the connection.
+		if pc.idleTimer.Stop() {
+			pc.reused = true
+			return pc
+		}
+	}
+	return nil
+}
+
+func (c *Client) putIdle(pc *conn) {
+	max := c.MaxIdleConnsPerHost
+	if max == 0 {
+		max = DefaultMaxIdleConnsPerHost
+	}
+	timeout := c.IdleConnTimeout
+	if timeout <= 0 {
+		timeout = DefaultIdleConnTimeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if max < 0 || len(c.idle[pc.key]) >= max {
+		pc.nc.Close()
+		return
+	}
+	if c.idle == nil {
+		c.idle = map[string][]*conn{}
+	}
+	pc.nc.SetDeadline(time.Time{})
+	pc.idleTimer = time.AfterFunc(timeout, func() { c.removeIdle(pc) })
+	c.idle[pc.key] = append(c.idle[pc.key], pc)
+}
+
+func (c *Client) removeIdle(pc *conn) {
+	c.mu.Lock()
+	conns := c.idle[pc.key]
+	for i, other := range conns {
+		if other == pc {
+			c.idle[pc.key] = append(conns[:i], conns[i+1:]...)
+			break
+		}
+	}
+	c.mu.Unlock()
+	pc.nc.Close()
+}
+
+// CloseIdleConnections closes the pooled connections not in use.
+func (c *Client) CloseIdleConnections() {
+	c.mu.Lock()
+	idle := c.idle
+	c.idle = nil
+	c.mu.Unlock()
+
+	for _, conns := range idle {
+		for _, pc := range conns {
+			pc.idleTimer.Stop()
+			pc.nc.Close()
+		}
+	}
+}
+
+// idleCount returns the number of pooled connections, for tests.
+func (c *Client) idleCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for _, conns := range c.idle {
+		n += len(conns)
+	}
+	return n
+}
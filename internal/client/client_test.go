@@ -0,0 +1,359 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shubh-man007/TinyProto/internal/headers"
+	"github.com/shubh-man007/TinyProto/internal/prototest"
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/shubh-man007/TinyProto/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reply(w *response.Writer, code response.StatusCode, h *headers.Headers, body string) {
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	h.Replace("Content-Length", strconv.Itoa(len(body)))
+	w.WriteStatusLine(code)
+	w.WriteHeaders(h)
+	if body != "" {
+		w.WriteBody([]byte(body))
+	}
+}
+
+// upstream answers by path: /chunked with a chunked body and trailer, /slow
+// only once the request is cancelled, /stall with half a chunked body, /loop
+// with a redirect to itself, /redirect/{code} with a redirect to the "to"
+// query parameter, and anything else with the method, path and body.
+func upstream(w *response.Writer, req *request.Request) {
+	switch {
+	case req.Target.Path == "/chunked":
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		h.Set("Trailer", "X-Sum")
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(h)
+		w.WriteChunk([]byte("hello "))
+		w.WriteChunk([]byte("world"))
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Sum", "42")
+		w.WriteChunkedDone(trailers)
+
+	case req.Target.Path == "/slow":
+		select {
+		case <-req.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		reply(w, response.StatusOK, nil, "late")
+
+	case req.Target.Path == "/stall":
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(h)
+		w.WriteChunk([]byte("partial"))
+		select {
+		case <-req.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+
+	case req.Target.Path == "/loop":
+		h := headers.NewHeaders()
+		h.Set("Location", "/loop")
+		reply(w, response.StatusFound, h, "again")
+
+	case strings.HasPrefix(req.Target.Path, "/redirect/"):
+		code, _ := strconv.Atoi(strings.TrimPrefix(req.Target.Path, "/redirect/"))
+		h := headers.NewHeaders()
+		h.Set("Location", req.Target.Query.Get("to"))
+		reply(w, response.StatusCode(code), h, "moved")
+
+	default:
+		data, _ := io.ReadAll(req.Body)
+		body := req.RequestLine.Method + " " + req.Target.Path + " " + string(data)
+		if auth := req.Header.Get("Authorization"); auth != "" {
+			body += " auth=" + auth
+		}
+		reply(w, response.StatusOK, nil, body)
+	}
+}
+
+// countingClient returns a client counting the connections it dials.
+func countingClient(dials *atomic.Int32) *Client {
+	c := NewClient()
+	c.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials.Add(1)
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	return c
+}
+
+func readAll(t *testing.T, res *response.Response) string {
+	t.Helper()
+	data, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestClientDo(t *testing.T) {
+	s := prototest.NewServer(upstream)
+	defer s.Close()
+	var dials atomic.Int32
+	c := countingClient(&dials)
+	defer c.CloseIdleConnections()
+	ctx := context.Background()
+
+	// Test: A GET and its body
+	res, err := c.Get(ctx, s.URL+"/echo")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusOK, res.StatusCode)
+	assert.Equal(t, "GET /echo ", readAll(t, res))
+	assert.Equal(t, 1, c.idleCount())
+
+	// Test: The connection is reused for the next request
+	req, err := request.NewRequest(ctx, "POST", s.URL+"/echo", strings.NewReader("data"))
+	require.NoError(t, err)
+	res, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "POST /echo data", readAll(t, res))
+	assert.Equal(t, int32(1), dials.Load())
+
+	// Test: Chunked upload, chunked download with trailers
+	req, err = request.NewRequest(ctx, "PUT", s.URL+"/echo", io.MultiReader(strings.NewReader("a"), strings.NewReader("b")))
+	require.NoError(t, err)
+	res, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "PUT /echo ab", readAll(t, res))
+	res, err = c.Get(ctx, s.URL+"/chunked")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", readAll(t, res))
+	assert.Equal(t, "42", res.Trailer.Get("X-Sum"))
+	assert.Equal(t, int32(1), dials.Load())
+
+	// Test: A body closed early gives up its connection
+	res, err = c.Get(ctx, s.URL+"/chunked")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 0, c.idleCount())
+	res, err = c.Get(ctx, s.URL+"/echo")
+	require.NoError(t, err)
+	readAll(t, res)
+	assert.Equal(t, int32(2), dials.Load())
+
+	// Test: Requests without an absolute URL are refused
+	served, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = c.Do(served)
+	assert.ErrorIs(t, err, request.ErrInvalidURL)
+}
+
+func TestClientPool(t *testing.T) {
+	s := prototest.NewUnstartedServer(upstream)
+	s.Server.IdleTimeout = 50 * time.Millisecond
+	s.Start()
+	defer s.Close()
+	var dials atomic.Int32
+	c := countingClient(&dials)
+	ctx := context.Background()
+
+	// Test: A pooled connection closed by the server is replaced
+	res, err := c.Get(ctx, s.URL+"/echo")
+	require.NoError(t, err)
+	readAll(t, res)
+	time.Sleep(150 * time.Millisecond)
+	req, err := request.NewRequest(ctx, "POST", s.URL+"/echo", strings.NewReader("again"))
+	require.NoError(t, err)
+	res, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "POST /echo again", readAll(t, res))
+	assert.Equal(t, int32(2), dials.Load())
+
+	// Test: Idle connections expire
+	c.IdleConnTimeout = 20 * time.Millisecond
+	res, err = c.Get(ctx, s.URL+"/echo")
+	require.NoError(t, err)
+	readAll(t, res)
+	assert.Equal(t, 1, c.idleCount())
+	assert.Eventually(t, func() bool { return c.idleCount() == 0 }, time.Second, 5*time.Millisecond)
+
+	// Test: Pooling disabled
+	c.MaxIdleConnsPerHost = -1
+	res, err = c.Get(ctx, s.URL+"/echo")
+	require.NoError(t, err)
+	readAll(t, res)
+	assert.Equal(t, 0, c.idleCount())
+
+	// Test: A body running to the end of the stream is never pooled
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\nuntil close"))
+		conn.Close()
+	}()
+	c = NewClient()
+	res, err = c.Get(ctx, "http://"+l.Addr().String()+"/")
+	require.NoError(t, err)
+	assert.True(t, res.Close)
+	assert.Equal(t, "until close", readAll(t, res))
+	assert.Equal(t, 0, c.idleCount())
+}
+
+func TestClientRedirects(t *testing.T) {
+	s := prototest.NewServer(upstream)
+	defer s.Close()
+	other := prototest.NewServer(upstream)
+	defer other.Close()
+	c := NewClient()
+	defer c.CloseIdleConnections()
+	ctx := context.Background()
+
+	post := func(path, body string) *request.Request {
+		req, err := request.NewRequest(ctx, "POST", s.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		return req
+	}
+
+	// Test: Relative Location, 302 turns a POST into a GET
+	res, err := c.Do(post("/redirect/302?to=/echo", "body"))
+	require.NoError(t, err)
+	assert.Equal(t, "GET /echo ", readAll(t, res))
+
+	// Test: 307 and 308 resend the method and body
+	res, err = c.Do(post("/redirect/307?to=/echo", "body"))
+	require.NoError(t, err)
+	assert.Equal(t, "POST /echo body", readAll(t, res))
+	res, err = c.Do(post("/redirect/308?to="+s.URL+"/echo", "body"))
+	require.NoError(t, err)
+	assert.Equal(t, "POST /echo body", readAll(t, res))
+
+	// Test: A streamed body cannot be resent, the redirect is returned
+	req, err := request.NewRequest(ctx, "POST", s.URL+"/redirect/307?to=/echo", io.MultiReader(strings.NewReader("x")))
+	require.NoError(t, err)
+	res, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusTemporaryRedirect, res.StatusCode)
+	readAll(t, res)
+
+	// Test: Credentials stay on the same host only
+	req, err = request.NewRequest(ctx, "GET", s.URL+"/redirect/302?to=/echo", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "secret")
+	res, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "GET /echo  auth=secret", readAll(t, res))
+	req, err = request.NewRequest(ctx, "GET", s.URL+"/redirect/302?to="+other.URL+"/echo", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "secret")
+	res, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "GET /echo ", readAll(t, res))
+
+	// Test: Redirect loops stop at the limit
+	_, err = c.Get(ctx, s.URL+"/loop")
+	assert.ErrorIs(t, err, ErrTooManyRedirects)
+
+	// Test: Policies returning the redirect or an error
+	c.CheckRedirect = NoRedirects
+	res, err = c.Get(ctx, s.URL+"/redirect/303?to=/echo")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusSeeOther, res.StatusCode)
+	assert.Equal(t, "/echo", res.Header.Get("Location"))
+	assert.Equal(t, "moved", readAll(t, res))
+	denied := errors.New("denied")
+	c.CheckRedirect = func(req *request.Request, via []*request.Request) error {
+		assert.Len(t, via, 1)
+		return denied
+	}
+	_, err = c.Get(ctx, s.URL+"/redirect/302?to=/echo")
+	assert.ErrorIs(t, err, denied)
+}
+
+func TestClientTimeouts(t *testing.T) {
+	s := prototest.NewServer(upstream)
+	defer s.Close()
+	c := NewClient()
+	defer c.CloseIdleConnections()
+
+	// Test: The request context bounds waiting for the response
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.Get(ctx, s.URL+"/slow")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// Test: Client.Timeout bounds reading the body too
+	c.Timeout = 100 * time.Millisecond
+	res, err := c.Get(context.Background(), s.URL+"/stall")
+	require.NoError(t, err)
+	_, err = io.ReadAll(res.Body)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, c.idleCount())
+
+	// Test: An already cancelled context sends nothing
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = c.Get(ctx, s.URL+"/echo")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestClientTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	s := server.NewServer()
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}}}
+	require.NoError(t, s.ServeTLS(0, upstream, "", ""))
+	defer s.Close()
+	url := "https://localhost:" + strconv.Itoa(s.Port) + "/echo"
+
+	// Test: The server certificate is verified
+	c := NewClient()
+	_, err = c.Get(context.Background(), url)
+	assert.Error(t, err)
+
+	// Test: With the certificate trusted the exchange goes through
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	c.TLSConfig = &tls.Config{RootCAs: roots}
+	res, err := c.Get(context.Background(), url)
+	require.NoError(t, err)
+	assert.Equal(t, "GET /echo ", readAll(t, res))
+	c.CloseIdleConnections()
+}
@@ -0,0 +1,227 @@
+package cookie
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeFormat is the IMF-fixdate format used for the Expires attribute.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+var (
+	ErrInvalidName      = errors.New("error: invalid cookie name")
+	ErrInvalidValue     = errors.New("error: invalid cookie value")
+	ErrInvalidAttribute = errors.New("error: invalid cookie attribute")
+)
+
+// SameSite is the SameSite attribute of a cookie.
+type SameSite int
+
+const (
+	// SameSiteDefault leaves the attribute out.
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+// Cookie is a cookie as received in a Cookie header, where only Name and
+// Value are set, or as sent in a Set-Cookie line.
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path    string
+	Domain  string
+	Expires time.Time
+	// MaxAge is the lifetime in seconds. Zero leaves the attribute out, a
+	// negative value sends "Max-Age=0" to delete the cookie right away.
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Parse parses the value of a Cookie header into its cookies, in order.
+// Pairs with an invalid name or value are skipped.
+func Parse(line string) []*Cookie {
+	var cookies []*Cookie
+	for line != "" {
+		var pair string
+		pair, line, _ = strings.Cut(line, ";")
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || !validName(name) {
+			continue
+		}
+		value, ok = parseValue(value)
+		if !ok {
+			continue
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: value})
+	}
+	return cookies
+}
+
+// Valid checks c against RFC 6265 before it is sent. Partitioned cookies and
+// SameSite=None ones must be Secure, as browsers drop them otherwise.
+func (c *Cookie) Valid() error {
+	if !validName(c.Name) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, c.Name)
+	}
+	if !validValue(c.Value) {
+		return fmt.Errorf("%w: %q", ErrInvalidValue, c.Value)
+	}
+	if !validAttrValue(c.Path) {
+		return fmt.Errorf("%w: path %q", ErrInvalidAttribute, c.Path)
+	}
+	if !validDomain(c.Domain) {
+		return fmt.Errorf("%w: domain %q", ErrInvalidAttribute, c.Domain)
+	}
+	if !c.Expires.IsZero() && c.Expires.UTC().Year() < 1601 {
+		return fmt.Errorf("%w: expires %v", ErrInvalidAttribute, c.Expires)
+	}
+	if c.SameSite < SameSiteDefault || c.SameSite > SameSiteNone {
+		return fmt.Errorf("%w: samesite %d", ErrInvalidAttribute, c.SameSite)
+	}
+	if (c.Partitioned || c.SameSite == SameSiteNone) && !c.Secure {
+		return fmt.Errorf("%w: partitioned and samesite=none cookies must be secure", ErrInvalidAttribute)
+	}
+	return nil
+}
+
+// String serializes c as the value of a Set-Cookie line. It does not check
+// c, call Valid for that.
+func (c *Cookie) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	b.WriteString(c.Value)
+
+	if c.Path != "" {
+		b.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=" + c.Expires.UTC().Format(TimeFormat))
+	}
+	switch {
+	case c.MaxAge > 0:
+		b.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	case c.MaxAge < 0:
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+// validName reports whether name is an RFC 9110 token, as RFC 6265 requires.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isTokenChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
+
+// isCookieOctet reports whether c may appear in a cookie value: visible
+// ASCII except DQUOTE, comma, semicolon and backslash.
+func isCookieOctet(c byte) bool {
+	return 0x21 <= c && c <= 0x7e && c != '"' && c != ',' && c != ';' && c != '\\'
+}
+
+func validValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if !isCookieOctet(value[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseValue strips the optional quotes around a received cookie value and
+// reports whether what is left is made of cookie octets.
+func parseValue(raw string) (string, bool) {
+	if len(raw) > 1 && raw[0] == '"' && raw[len(raw)-1] == '"' {
+		raw = raw[1 : len(raw)-1]
+	}
+	for i := 0; i < len(raw); i++ {
+		if !isCookieOctet(raw[i]) {
+			return "", false
+		}
+	}
+	return raw, true
+}
+
+// validAttrValue reports whether v can be an attribute value, which ends at
+// the next ';'.
+func validAttrValue(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if v[i] < 0x20 || v[i] == 0x7f || v[i] == ';' {
+			return false
+		}
+	}
+	return true
+}
+
+// validDomain accepts an empty domain or a host name, with an optional
+// leading dot that String drops.
+func validDomain(domain string) bool {
+	domain = strings.TrimPrefix(domain, ".")
+	if domain == "" {
+		return true
+	}
+	if len(domain) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package cookie
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	// Test: Pairs in order, quotes stripped, repeated names kept
+	cookies := Parse(`session=abc123; theme="dark"; session=older;  lang=en`)
+	require.Len(t, cookies, 4)
+	assert.Equal(t, &Cookie{Name: "session", Value: "abc123"}, cookies[0])
+	assert.Equal(t, "dark", cookies[1].Value)
+	assert.Equal(t, "older", cookies[2].Value)
+	assert.Equal(t, "lang", cookies[3].Name)
+
+	// Test: Empty values are allowed
+	cookies = Parse("empty=; other=1")
+	require.Len(t, cookies, 2)
+	assert.Equal(t, "", cookies[0].Value)
+
+	// Test: Malformed pairs are skipped
+	cookies = Parse(`noequals; bad name=1; val=has space; q="unterminated; ok=yes; ;`)
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "ok", cookies[0].Name)
+	assert.Empty(t, Parse(""))
+}
+
+func TestString(t *testing.T) {
+	// Test: Every attribute
+	c := &Cookie{
+		Name:        "id",
+		Value:       "a3fWa",
+		Path:        "/docs",
+		Domain:      ".example.com",
+		Expires:     time.Date(2025, time.October, 21, 7, 28, 0, 0, time.FixedZone("X", 3600)),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, "id=a3fWa; Path=/docs; Domain=example.com; "+
+		"Expires=Tue, 21 Oct 2025 06:28:00 GMT; Max-Age=3600; Secure; HttpOnly; "+
+		"SameSite=None; Partitioned", c.String())
+
+	// Test: Deleting a cookie
+	c = &Cookie{Name: "gone", MaxAge: -1, SameSite: SameSiteStrict}
+	assert.Equal(t, "gone=; Max-Age=0; SameSite=Strict", c.String())
+
+	// Test: Valid cookies read back as they were written
+	for _, value := range []string{"", "abc123", "a.b-c_d~e!#$%&'()*+/:<=>?@[]^`{|}"} {
+		c = &Cookie{Name: "k", Value: value}
+		require.NoError(t, c.Valid(), value)
+		cookies := Parse(c.String())
+		require.Len(t, cookies, 1, value)
+		assert.Equal(t, c, cookies[0])
+	}
+}
+
+func TestValid(t *testing.T) {
+	// Test: RFC 6265 names, values and attributes
+	cases := []struct {
+		cookie *Cookie
+		err    error
+	}{
+		{&Cookie{Name: "", Value: "x"}, ErrInvalidName},
+		{&Cookie{Name: "a=b", Value: "x"}, ErrInvalidName},
+		{&Cookie{Name: "a b", Value: "x"}, ErrInvalidName},
+		{&Cookie{Name: "a", Value: "semi;colon"}, ErrInvalidValue},
+		{&Cookie{Name: "a", Value: `quo"te`}, ErrInvalidValue},
+		{&Cookie{Name: "a", Value: "back\\slash"}, ErrInvalidValue},
+		{&Cookie{Name: "a", Value: "new\r\nline"}, ErrInvalidValue},
+		{&Cookie{Name: "a", Value: "hello world"}, ErrInvalidValue},
+		{&Cookie{Name: "a", Value: "x,y"}, ErrInvalidValue},
+		{&Cookie{Name: "a", Path: "/x; Secure"}, ErrInvalidAttribute},
+		{&Cookie{Name: "a", Domain: "exa mple.com"}, ErrInvalidAttribute},
+		{&Cookie{Name: "a", Domain: "-bad.com"}, ErrInvalidAttribute},
+		{&Cookie{Name: "a", Expires: time.Date(1500, 1, 1, 0, 0, 0, 0, time.UTC)}, ErrInvalidAttribute},
+		{&Cookie{Name: "a", SameSite: SameSiteNone}, ErrInvalidAttribute},
+		{&Cookie{Name: "a", Partitioned: true}, ErrInvalidAttribute},
+		{&Cookie{Name: "a", SameSite: 7}, ErrInvalidAttribute},
+	}
+	for _, tc := range cases {
+		assert.ErrorIs(t, tc.cookie.Valid(), tc.err, tc.cookie.String())
+	}
+	assert.NoError(t, (&Cookie{Name: "__Host-id", Value: "x.y", Path: "/", Secure: true}).Valid())
+}
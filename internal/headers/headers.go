@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"iter"
 	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -12,41 +14,221 @@ const CRLF = "\r\n"
 
 var fieldNameConstraint = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+\-.^_` + "`" + `|~]+$`)
 
+var (
+	ErrInvalidFieldName  = errors.New("invalid tchar for field-name")
+	ErrInvalidFieldValue = errors.New("field-value contains CR, LF or NUL")
+	// ErrWhitespaceBeforeColon is returned by ParseStrict for a field line
+	// with whitespace between the name and the colon.
+	ErrWhitespaceBeforeColon = errors.New("whitespace between field-name and colon")
+	// ErrObsFold is returned by ParseStrict for a line starting with
+	// whitespace, an obsolete continuation of the previous field line.
+	ErrObsFold = errors.New("obsolete line folding in field section")
+	// ErrInvalidFieldLine is returned for a field line without a colon, or
+	// with a space right before it.
+	ErrInvalidFieldLine = errors.New("invalid field-line syntax")
+)
+
+// FieldError reports a field that cannot be stored or sent because it could
+// corrupt the message, e.g. a value smuggling in an extra header line.
+type FieldError struct {
+	Name string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("header %q: %s", e.Name, e.Err.Error())
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateField checks that name is a token and that value holds no CR, LF
+// or NUL. It returns a *FieldError otherwise.
+func ValidateField(name, value string) error {
+	if !fieldNameConstraint.MatchString(name) {
+		return &FieldError{Name: name, Err: ErrInvalidFieldName}
+	}
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return &FieldError{Name: name, Err: ErrInvalidFieldValue}
+	}
+	return nil
+}
+
+// Headers is an ordered list of field lines. Each line keeps the name as it
+// was given, lookups by name are case-insensitive.
 type Headers struct {
-	header map[string]string
+	fields []field
+}
+
+type field struct {
+	name  string
+	value string
 }
 
 func NewHeaders() *Headers {
-	return &Headers{
-		header: map[string]string{},
-	}
+	return &Headers{}
 }
 
+// Get returns the first value of name, or "" if it is not present.
 func (h *Headers) Get(name string) string {
-	return h.header[strings.ToLower(name)]
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, name) {
+			return f.value
+		}
+	}
+	return ""
+}
+
+// Values returns every value of name in the order the lines were added.
+func (h *Headers) Values(name string) []string {
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, name) {
+			values = append(values, f.value)
+		}
+	}
+	return values
 }
 
-func (h *Headers) Set(name, value string) {
-	v, ok := h.header[strings.ToLower(name)]
-	if !ok {
-		h.header[strings.ToLower(name)] = value
-	} else {
-		h.header[strings.ToLower(name)] = fmt.Sprintf("%s,%s", v, value)
+// Tokens returns the comma-separated elements of every value of name,
+// trimmed and without empty elements. It suits list-valued fields such as
+// Connection, Transfer-Encoding or Trailer.
+func (h *Headers) Tokens(name string) []string {
+	var tokens []string
+	for _, value := range h.Values(name) {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
 	}
+	return tokens
 }
 
-func (h *Headers) Replace(name, value string) {
-	h.header[strings.ToLower(name)] = value
+// Add appends a field line, keeping any existing lines with the same name.
+// Invalid fields are rejected with a *FieldError and not stored.
+func (h *Headers) Add(name, value string) error {
+	if err := ValidateField(name, value); err != nil {
+		return err
+	}
+	h.fields = append(h.fields, field{name: name, value: value})
+	return nil
+}
+
+// Set adds a field line, the same as Add. Repeated names are kept as separate
+// lines rather than joined with commas, which fields like Set-Cookie rely on.
+func (h *Headers) Set(name, value string) error {
+	return h.Add(name, value)
+}
+
+// Replace sets name to a single value. The line takes the place of the first
+// existing line with that name, or is appended if there is none. Invalid
+// fields are rejected with a *FieldError, leaving h unchanged.
+func (h *Headers) Replace(name, value string) error {
+	if err := ValidateField(name, value); err != nil {
+		return err
+	}
+
+	replaced := false
+	fields := h.fields[:0]
+	for _, f := range h.fields {
+		if !strings.EqualFold(f.name, name) {
+			fields = append(fields, f)
+			continue
+		}
+		if !replaced {
+			fields = append(fields, field{name: name, value: value})
+			replaced = true
+		}
+	}
+	h.fields = fields
+	if !replaced {
+		h.fields = append(h.fields, field{name: name, value: value})
+	}
+	return nil
 }
 
 func (h *Headers) Delete(name string) {
-	delete(h.header, strings.ToLower(name))
+	fields := h.fields[:0]
+	for _, f := range h.fields {
+		if !strings.EqualFold(f.name, name) {
+			fields = append(fields, f)
+		}
+	}
+	h.fields = fields
+}
+
+// Iter yields every field line in order, with names as they were added.
+func (h *Headers) Iter() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for _, f := range h.fields {
+			if !yield(f.name, f.value) {
+				return
+			}
+		}
+	}
+}
+
+// Validate checks every field line with ValidateField.
+func (h *Headers) Validate() error {
+	for _, f := range h.fields {
+		if err := ValidateField(f.name, f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Len returns the number of field lines.
+func (h *Headers) Len() int {
+	return len(h.fields)
 }
-func (h *Headers) Iter() map[string]string {
-	return h.header
+
+// Clone returns a copy of h that can be changed without affecting h.
+func (h *Headers) Clone() *Headers {
+	return &Headers{fields: slices.Clone(h.fields)}
+}
+
+// Canonicalize rewrites every name into its canonical form, see
+// CanonicalName.
+func (h *Headers) Canonicalize() {
+	for i := range h.fields {
+		h.fields[i].name = CanonicalName(h.fields[i].name)
+	}
+}
+
+// CanonicalName returns name with the first letter and every letter after a
+// hyphen upper-cased and the rest lower-cased, e.g. "content-type" becomes
+// "Content-Type".
+func CanonicalName(name string) string {
+	b := []byte(name)
+	upper := true
+	for i, c := range b {
+		switch {
+		case upper && 'a' <= c && c <= 'z':
+			b[i] = c - ('a' - 'A')
+		case !upper && 'A' <= c && c <= 'Z':
+			b[i] = c + ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(b)
 }
 
 func (h *Headers) Parse(data []byte) (int, bool, error) {
+	return h.parse(data, false)
+}
+
+// ParseStrict is Parse for servers behind a proxy, where any leniency can
+// let the two disagree on message boundaries. It also rejects whitespace
+// before the colon (ErrWhitespaceBeforeColon) and lines starting with
+// whitespace (ErrObsFold), as RFC 9112 section 5 requires.
+func (h *Headers) ParseStrict(data []byte) (int, bool, error) {
+	return h.parse(data, true)
+}
+
+func (h *Headers) parse(data []byte, strict bool) (int, bool, error) {
 	bytesConsumed := 0
 
 	for len(data) > 0 {
@@ -59,21 +241,30 @@ func (h *Headers) Parse(data []byte) (int, bool, error) {
 			return bytesConsumed + len(CRLF), true, nil
 		}
 
-		line := strings.TrimSpace(string(data[:idxCRLF]))
+		line := string(data[:idxCRLF])
+		if strict {
+			if line[0] == ' ' || line[0] == '\t' {
+				return bytesConsumed, false, ErrObsFold
+			}
+			name, _, _ := strings.Cut(line, ":")
+			if strings.TrimRight(name, " \t") != name {
+				return bytesConsumed, false, ErrWhitespaceBeforeColon
+			}
+		}
+
+		line = strings.TrimSpace(line)
 		colonIdx := strings.Index(line, ":")
 		if colonIdx == -1 || (colonIdx > 0 && line[colonIdx-1] == ' ') {
-			return bytesConsumed, false, errors.New("invalid field-line syntax")
+			return bytesConsumed, false, ErrInvalidFieldLine
 		}
 
 		key := strings.TrimSpace(line[:colonIdx])
 		value := strings.TrimSpace(line[colonIdx+1:])
 
-		if !fieldNameConstraint.Match([]byte(key)) {
-			return bytesConsumed, false, errors.New("invalid tchar for field-name")
+		if err := h.Add(key, value); err != nil {
+			return bytesConsumed, false, err
 		}
 
-		h.Set(key, value)
-
 		consumed := idxCRLF + len(CRLF)
 		bytesConsumed += consumed
 		data = data[consumed:]
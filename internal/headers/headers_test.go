@@ -79,7 +79,121 @@ func TestFieldLineParser(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, 86, n)
 	assert.True(t, done)
-	assert.Equal(t, "lane-loves-go,prime-loves-zig,tj-loves-ocaml", headers.Get("Set-Person"))
+	assert.Equal(t, "lane-loves-go", headers.Get("Set-Person"))
+	assert.Equal(t, []string{"lane-loves-go", "prime-loves-zig", "tj-loves-ocaml"}, headers.Values("set-person"))
+}
+
+func TestHeadersOrder(t *testing.T) {
+	// Test: Lines keep their order, casing and every value
+	headers := NewHeaders()
+	data := []byte("Host: localhost\r\nSet-Cookie: a=1\r\nX-Trace: 1\r\nset-cookie: b=2\r\n\r\n")
+	_, done, err := headers.Parse(data)
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, 4, headers.Len())
+	assert.Equal(t, "a=1", headers.Get("SET-COOKIE"))
+	assert.Equal(t, []string{"a=1", "b=2"}, headers.Values("Set-Cookie"))
+
+	var lines []string
+	for key, value := range headers.Iter() {
+		lines = append(lines, key+": "+value)
+	}
+	assert.Equal(t, []string{"Host: localhost", "Set-Cookie: a=1", "X-Trace: 1", "set-cookie: b=2"}, lines)
+
+	// Test: Replace takes the place of the first line
+	headers.Replace("Set-Cookie", "c=3")
+	lines = nil
+	for key, value := range headers.Iter() {
+		lines = append(lines, key+": "+value)
+	}
+	assert.Equal(t, []string{"Host: localhost", "Set-Cookie: c=3", "X-Trace: 1"}, lines)
+
+	// Test: Delete removes every line
+	headers.Add("x-trace", "2")
+	headers.Delete("X-TRACE")
+	assert.Nil(t, headers.Values("X-Trace"))
+	assert.Equal(t, 2, headers.Len())
+
+	// Test: Tokens splits list values across lines
+	headers = NewHeaders()
+	headers.Add("Connection", "keep-alive, Upgrade")
+	headers.Add("Connection", " close ,")
+	assert.Equal(t, []string{"keep-alive", "Upgrade", "close"}, headers.Tokens("connection"))
+
+	// Test: Clone leaves the original alone
+	clone := headers.Clone()
+	clone.Replace("Connection", "close")
+	clone.Add("X-Trace", "1")
+	assert.Equal(t, []string{"keep-alive, Upgrade", " close ,"}, headers.Values("Connection"))
+	assert.Equal(t, 2, headers.Len())
+
+	// Test: Canonical names
+	assert.Equal(t, "Content-Type", CanonicalName("content-type"))
+	assert.Equal(t, "X-Request-Id", CanonicalName("X-REQUEST-ID"))
+	assert.Equal(t, "Www-Authenticate", CanonicalName("www-authenticate"))
+	headers.Canonicalize()
+	for key := range headers.Iter() {
+		assert.Equal(t, "Connection", key)
+	}
+}
+
+func TestFieldValidation(t *testing.T) {
+	// Test: Values carrying CR, LF or NUL are rejected
+	headers := NewHeaders()
+	for _, value := range []string{"a\r\nSet-Cookie: evil=1", "a\nb", "a\rb", "a\x00b"} {
+		err := headers.Set("X-Echo", value)
+		require.Error(t, err)
+		var fieldErr *FieldError
+		require.ErrorAs(t, err, &fieldErr)
+		assert.Equal(t, "X-Echo", fieldErr.Name)
+		assert.ErrorIs(t, err, ErrInvalidFieldValue)
+	}
+	assert.Equal(t, 0, headers.Len())
+
+	// Test: Names that are not tokens are rejected
+	err := headers.Add("X Echo", "value")
+	assert.ErrorIs(t, err, ErrInvalidFieldName)
+	err = headers.Replace("X-Echo:", "value")
+	assert.ErrorIs(t, err, ErrInvalidFieldName)
+	err = headers.Set("", "value")
+	assert.ErrorIs(t, err, ErrInvalidFieldName)
+
+	// Test: Replace leaves the existing value when rejecting
+	require.NoError(t, headers.Set("X-Echo", "safe"))
+	require.Error(t, headers.Replace("X-Echo", "bad\r\n"))
+	assert.Equal(t, "safe", headers.Get("X-Echo"))
+	require.NoError(t, headers.Validate())
+
+	// Test: Parsed values with NUL are rejected
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X-Echo: a\x00b\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrInvalidFieldValue)
 }
 
 // go test ./...
+
+func TestParseStrict(t *testing.T) {
+	// Test: Whitespace before the colon
+	for _, line := range []string{"Host : x\r\n\r\n", "Host\t: x\r\n\r\n"} {
+		_, _, err := NewHeaders().ParseStrict([]byte(line))
+		assert.ErrorIs(t, err, ErrWhitespaceBeforeColon, line)
+	}
+
+	// Test: Obsolete line folding, accepted as its own field by Parse
+	data := []byte("X-A: 1\r\n X-B: 2\r\n\r\n")
+	_, _, err := NewHeaders().ParseStrict(data)
+	assert.ErrorIs(t, err, ErrObsFold)
+	headers := NewHeaders()
+	_, done, err := headers.Parse(data)
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, "2", headers.Get("X-B"))
+
+	// Test: Clean field lines parse the same as Parse
+	headers = NewHeaders()
+	n, done, err := headers.ParseStrict([]byte("Host: localhost\r\nX-Empty:\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, 29, n)
+	assert.Equal(t, "localhost", headers.Get("Host"))
+}
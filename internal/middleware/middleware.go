@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/shubh-man007/TinyProto/internal/headers"
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/shubh-man007/TinyProto/internal/server"
+)
+
+// Middleware wraps a handler with extra behavior.
+type Middleware func(server.Handler) server.Handler
+
+// Chain wraps h with mws. The first middleware is the outermost, so it sees
+// the request first and the finished response last.
+func Chain(h server.Handler, mws ...Middleware) server.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// Logger logs the method, target, final status code, body size and duration
+// of every request.
+func Logger(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		start := time.Now()
+		next(w, req)
+		log.Printf("%s %s -> %d (%d bytes) in %s",
+			req.RequestLine.Method, req.RequestLine.RequestTarget,
+			w.StatusCode(), w.BytesWritten(), time.Since(start))
+	}
+}
+
+// Recover turns a panic in the handler into a 500 response. If the handler
+// already started its response the panic is only logged, since the status
+// line cannot be taken back.
+func Recover(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			log.Printf("panic serving %s %s: %v\n%s",
+				req.RequestLine.Method, req.RequestLine.RequestTarget, rec, debug.Stack())
+
+			if w.Status != response.WriterStatusInit {
+				return
+			}
+			body := []byte(response.StatusText(response.StatusInternalServerError))
+			h := response.GetDefaultHeaders(len(body))
+			h.Replace("Connection", "close")
+			if err := w.WriteStatusLine(response.StatusInternalServerError); err != nil {
+				return
+			}
+			if err := w.WriteHeaders(h); err != nil {
+				return
+			}
+			w.WriteBody(body)
+		}()
+		next(w, req)
+	}
+}
+
+// DefaultHeaders adds the given fields to every response that does not set
+// them itself, in the order they were added to fields. Invalid fields are
+// logged and skipped.
+func DefaultHeaders(fields *headers.Headers) Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			for name, value := range fields.Iter() {
+				if err := w.SetDefaultHeader(name, value); err != nil {
+					log.Printf("skipping default header: %v", err)
+				}
+			}
+			next(w, req)
+		}
+	}
+}
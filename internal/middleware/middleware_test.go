@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/shubh-man007/TinyProto/internal/headers"
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/shubh-man007/TinyProto/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hello(w *response.Writer, req *request.Request) {
+	body := []byte("hello")
+	w.WriteStatusLine(response.StatusCreated)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func newRequest(t *testing.T) *request.Request {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+func TestChain(t *testing.T) {
+	// Test: First middleware is outermost
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next server.Handler) server.Handler {
+			return func(w *response.Writer, req *request.Request) {
+				order = append(order, name+" in")
+				next(w, req)
+				order = append(order, name+" out")
+			}
+		}
+	}
+	var buf bytes.Buffer
+	h := Chain(hello, trace("a"), trace("b"))
+	h(response.NewWriter(&buf), newRequest(t))
+	assert.Equal(t, []string{"a in", "b in", "b out", "a out"}, order)
+
+	// Test: Status and byte count are visible after the handler
+	var code response.StatusCode
+	var n int
+	observe := func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			next(w, req)
+			code, n = w.StatusCode(), w.BytesWritten()
+		}
+	}
+	h = Chain(hello, Logger, observe)
+	h(response.NewWriter(&buf), newRequest(t))
+	assert.Equal(t, response.StatusCreated, code)
+	assert.Equal(t, 5, n)
+}
+
+func TestRecover(t *testing.T) {
+	// Test: Panic before the response starts becomes a 500
+	var buf bytes.Buffer
+	h := Chain(func(w *response.Writer, req *request.Request) {
+		panic("boom")
+	}, Recover)
+	w := response.NewWriter(&buf)
+	h(w, newRequest(t))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.Equal(t, response.StatusInternalServerError, w.StatusCode())
+
+	// Test: Panic after the status line is only logged
+	buf.Reset()
+	h = Chain(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		panic("late boom")
+	}, Recover)
+	w = response.NewWriter(&buf)
+	h(w, newRequest(t))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", buf.String())
+}
+
+func TestDefaultHeaders(t *testing.T) {
+	// Test: Defaults are added, handler values win
+	var buf bytes.Buffer
+	fields := headers.NewHeaders()
+	fields.Set("X-Frame-Options", "DENY")
+	fields.Set("Content-Type", "application/json")
+	h := Chain(hello, DefaultHeaders(fields))
+	h(response.NewWriter(&buf), newRequest(t))
+	assert.Contains(t, buf.String(), "X-Frame-Options: DENY\r\n")
+	assert.Contains(t, buf.String(), "Content-Type: text/plain\r\n")
+
+	// Test: Defaults go out in the order they were given
+	fields = headers.NewHeaders()
+	for _, name := range []string{"X-E", "X-D", "X-C", "X-B", "X-A"} {
+		fields.Set(name, "1")
+	}
+	h = Chain(hello, DefaultHeaders(fields))
+	for range 5 {
+		buf.Reset()
+		h(response.NewWriter(&buf), newRequest(t))
+		out := buf.String()
+		assert.Less(t, strings.Index(out, "X-E:"), strings.Index(out, "X-D:"))
+		assert.Less(t, strings.Index(out, "X-D:"), strings.Index(out, "X-C:"))
+		assert.Less(t, strings.Index(out, "X-C:"), strings.Index(out, "X-B:"))
+		assert.Less(t, strings.Index(out, "X-B:"), strings.Index(out, "X-A:"))
+	}
+}
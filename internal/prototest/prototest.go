@@ -0,0 +1,195 @@
+// Package prototest provides helpers for testing handlers: a recorder to run
+// them against without a connection, requests built from raw strings and a
+// server on a loopback port.
+package prototest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/shubh-man007/TinyProto/internal/headers"
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/shubh-man007/TinyProto/internal/server"
+)
+
+// closeTimeout bounds how long Server.Close waits for handlers to finish.
+const closeTimeout = 5 * time.Second
+
+// Result is a response as it was received, 1xx interim responses included.
+type Result struct {
+	Proto   string
+	Code    response.StatusCode
+	Header  *headers.Headers
+	Body    []byte
+	Trailer *headers.Headers
+	// Interim holds the 1xx responses sent before this one, with their code
+	// and header only.
+	Interim []*Result
+}
+
+// ResponseRecorder captures what a handler writes to Writer, to be inspected
+// with Result.
+type ResponseRecorder struct {
+	// Writer is the writer to pass to the handler. It behaves as for an
+	// HTTP/1.1 keep-alive request.
+	Writer *response.Writer
+
+	buf    bytes.Buffer
+	method string
+}
+
+func NewRecorder() *ResponseRecorder {
+	rec := &ResponseRecorder{}
+	rec.Writer = response.NewWriter(&rec.buf)
+	rec.Writer.SetKeepAlive(true)
+	return rec
+}
+
+// SetRequestMethod tells the recorder and its Writer the method of the
+// request being answered, so that a response to HEAD goes without a body.
+func (rec *ResponseRecorder) SetRequestMethod(method string) {
+	rec.Writer.SetRequestMethod(method)
+	rec.method = method
+}
+
+// Bytes returns everything written so far, as it would have gone on the
+// wire.
+func (rec *ResponseRecorder) Bytes() []byte {
+	return rec.buf.Bytes()
+}
+
+// Result parses what was written into its status, headers, body and
+// trailers. It fails if the handler has not written a complete response.
+func (rec *ResponseRecorder) Result() (*Result, error) {
+	method := rec.method
+	if method == "" {
+		method = "GET"
+	}
+	return ReadResponse(bufio.NewReader(bytes.NewReader(rec.buf.Bytes())), method)
+}
+
+// NewRequest parses raw into a request with its body read into memory, and
+// panics if raw is not a valid request. If raw holds no CRLF, its head may be
+// written with plain "\n" line endings; the body is taken as is.
+func NewRequest(raw string) *request.Request {
+	req, err := request.RequestFromReader(strings.NewReader(normalize(raw)))
+	if err != nil {
+		panic(fmt.Sprintf("prototest: invalid request: %v", err))
+	}
+	return req
+}
+
+// normalize turns the "\n" line endings of a request head into CRLF, and
+// ends the head with a blank line if it has none.
+func normalize(raw string) string {
+	if strings.Contains(raw, request.CRLF) {
+		return raw
+	}
+	head, body, _ := strings.Cut(raw, "\n\n")
+	head = strings.ReplaceAll(strings.TrimRight(head, "\n"), "\n", request.CRLF)
+	return head + request.CRLF + request.CRLF + body
+}
+
+// Server serves a handler on a loopback port for the duration of a test.
+type Server struct {
+	// URL is the base URL of the server, e.g. "http://127.0.0.1:41234". It
+	// is set by Start.
+	URL string
+	// Server is the server under test. Its fields may be set between
+	// NewUnstartedServer and Start.
+	Server *server.Server
+
+	handler server.Handler
+	addr    string
+}
+
+// NewServer starts serving h on a free loopback port, and panics if it cannot
+// listen. Close it when done.
+func NewServer(h server.Handler) *Server {
+	s := NewUnstartedServer(h)
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a server for h that is configured but not
+// listening yet, so that limits and timeouts can be set before Start.
+func NewUnstartedServer(h server.Handler) *Server {
+	return &Server{Server: server.NewServer(), handler: h}
+}
+
+// Start starts serving on a free loopback port, and panics if it cannot
+// listen.
+func (s *Server) Start() {
+	if err := s.Server.ServeAddr("tcp://127.0.0.1:0", s.handler); err != nil {
+		panic(fmt.Sprintf("prototest: failed to listen: %v", err))
+	}
+	s.addr = s.Server.Addr().String()
+	s.URL = "http://" + s.addr
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Do sends raw, normalized as in NewRequest, on a new connection and reads
+// the response to it.
+func (s *Server) Do(raw string) (*Result, error) {
+	conn, err := net.DialTimeout("tcp", s.Addr(), closeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(normalize(raw))); err != nil {
+		return nil, err
+	}
+	method, _, _ := strings.Cut(raw, " ")
+	return ReadResponse(bufio.NewReader(conn), method)
+}
+
+// Close shuts the server down, waiting for running handlers for a few
+// seconds before closing their connections.
+func (s *Server) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	if forced, err := s.Server.Shutdown(ctx); err != nil {
+		log.Printf("prototest: %d connection(s) closed forcibly: %v", forced, err)
+	}
+}
+
+// ReadResponse reads one response to a request with method off r, with the
+// interim responses before it, and reads its body into memory.
+func ReadResponse(r *bufio.Reader, method string) (*Result, error) {
+	var interim []*Result
+	for {
+		res, err := response.ReadResponse(r, method)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		result := &Result{Proto: res.Proto, Code: res.StatusCode, Header: res.Header}
+		if res.StatusCode >= 100 && res.StatusCode <= 199 && res.StatusCode != response.StatusSwitchingProtocols {
+			interim = append(interim, result)
+			continue
+		}
+
+		result.Interim = interim
+		if result.Body, err = io.ReadAll(res.Body); err != nil {
+			return nil, err
+		}
+		result.Trailer = res.Trailer
+		return result, nil
+	}
+}
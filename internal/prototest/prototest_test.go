@@ -0,0 +1,166 @@
+package prototest
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/shubh-man007/TinyProto/internal/headers"
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echo answers with the method, path and body of the request.
+func echo(w *response.Writer, req *request.Request) {
+	data, _ := io.ReadAll(req.Body)
+	body := []byte(req.RequestLine.Method + " " + req.Target.Path + " " + string(data))
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func TestRecorder(t *testing.T) {
+	// Test: Status, headers and body
+	rec := NewRecorder()
+	echo(rec.Writer, NewRequest("POST /items HTTP/1.1\nHost: x\nContent-Length: 3\n\nabc"))
+	res, err := rec.Result()
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1", res.Proto)
+	assert.Equal(t, response.StatusOK, res.Code)
+	assert.Equal(t, "text/plain", res.Header.Get("Content-Type"))
+	assert.Equal(t, "keep-alive", res.Header.Get("Connection"))
+	assert.Equal(t, "POST /items abc", string(res.Body))
+	assert.Empty(t, res.Interim)
+	assert.True(t, strings.HasPrefix(string(rec.Bytes()), "HTTP/1.1 200 OK\r\n"))
+
+	// Test: Interim responses, chunked body and trailers
+	rec = NewRecorder()
+	hints := headers.NewHeaders()
+	hints.Set("Link", "</style.css>; rel=preload")
+	require.NoError(t, rec.Writer.WriteInterim(response.StatusEarlyHints, hints))
+	require.NoError(t, rec.Writer.WriteStatusLine(response.StatusCreated))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, rec.Writer.WriteHeaders(h))
+	rec.Writer.WriteChunk([]byte("hello "))
+	rec.Writer.WriteChunk([]byte("world"))
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, rec.Writer.WriteChunkedDone(trailers))
+
+	res, err = rec.Result()
+	require.NoError(t, err)
+	require.Len(t, res.Interim, 1)
+	assert.Equal(t, response.StatusEarlyHints, res.Interim[0].Code)
+	assert.Equal(t, "</style.css>; rel=preload", res.Interim[0].Header.Get("Link"))
+	assert.Equal(t, response.StatusCreated, res.Code)
+	assert.Equal(t, "hello world", string(res.Body))
+	assert.Equal(t, "abc", res.Trailer.Get("X-Checksum"))
+
+	// Test: Response to HEAD
+	rec = NewRecorder()
+	rec.SetRequestMethod("HEAD")
+	echo(rec.Writer, NewRequest("HEAD /items HTTP/1.1\nHost: x"))
+	res, err = rec.Result()
+	require.NoError(t, err)
+	assert.Equal(t, "12", res.Header.Get("Content-Length"))
+	assert.Empty(t, res.Body)
+
+	// Test: Nothing or a partial response written
+	_, err = NewRecorder().Result()
+	assert.Error(t, err)
+	rec = NewRecorder()
+	rec.Writer.WriteStatusLine(response.StatusOK)
+	_, err = rec.Result()
+	assert.Error(t, err)
+}
+
+func TestNewRequest(t *testing.T) {
+	// Test: Plain "\n" line endings in the head
+	req := NewRequest("GET /search?q=go HTTP/1.1\nHost: example.com\nX-Id: 7")
+	assert.Equal(t, "/search", req.Target.Path)
+	assert.Equal(t, "go", req.Target.Query.Get("q"))
+	assert.Equal(t, "example.com", req.Header.Get("Host"))
+	assert.Equal(t, "7", req.Header.Get("X-Id"))
+
+	// Test: CRLF requests are taken as they are, chunked bodies included
+	req = NewRequest("POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"3\r\nabc\r\n0\r\nX-Sum: 1\r\n\r\n")
+	data, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(data))
+	assert.Equal(t, "1", req.Trailer.Get("X-Sum"))
+
+	// Test: Invalid requests panic
+	assert.Panics(t, func() { NewRequest("GET / HTTP/9.9\n\n") })
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer(echo)
+	assert.True(t, strings.HasPrefix(s.URL, "http://127.0.0.1:"))
+	assert.Equal(t, s.URL, "http://"+s.Addr())
+
+	// Test: A request over the loopback connection
+	res, err := s.Do("PUT /doc HTTP/1.1\nHost: x\nContent-Length: 4\nConnection: close\n\ndata")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusOK, res.Code)
+	assert.Equal(t, "PUT /doc data", string(res.Body))
+
+	// Test: A HEAD response is read without waiting for a body
+	res, err = s.Do("HEAD /doc HTTP/1.1\nHost: x\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusOK, res.Code)
+	assert.Equal(t, "10", res.Header.Get("Content-Length"))
+	assert.Empty(t, res.Body)
+
+	// Test: Closed servers refuse connections
+	s.Close()
+	_, err = s.Do("GET / HTTP/1.1\nHost: x\n\n")
+	assert.Error(t, err)
+
+	// Test: Server fields set before Start
+	s = NewUnstartedServer(echo)
+	s.Server.StrictParsing = true
+	s.Start()
+	defer s.Close()
+	res, err = s.Do("GET / HTTP/1.1\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusBadRequest, res.Code)
+}
+
+func TestReadResponse(t *testing.T) {
+	// Test: Body delimited by the end of the stream
+	res, err := ReadResponse(bufio.NewReader(strings.NewReader("HTTP/1.0 200 OK\r\nConnection: close\r\n\r\nraw body")), "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.0", res.Proto)
+	assert.Equal(t, "raw body", string(res.Body))
+
+	// Test: Response to HEAD has no body whatever its Content-Length
+	r := bufio.NewReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nHTTP/1.1 204 No Content\r\n\r\n"))
+	res, err = ReadResponse(r, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "5", res.Header.Get("Content-Length"))
+	assert.Empty(t, res.Body)
+	res, err = ReadResponse(r, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusNoContent, res.Code)
+
+	// Test: Malformed chunk framing
+	_, err = ReadResponse(bufio.NewReader(strings.NewReader("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n")), "GET")
+	assert.ErrorIs(t, err, response.ErrMalformedChunk)
+
+	// Test: Malformed responses
+	for _, raw := range []string{
+		"HTTP/1.1 2000 OK\r\n\r\n",
+		"SPDY 200 OK\r\n\r\n",
+		"HTTP/1.1 200 OK\nContent-Length: 0\n\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: -1\r\n\r\n",
+	} {
+		_, err := ReadResponse(bufio.NewReader(strings.NewReader(raw)), "GET")
+		assert.ErrorIs(t, err, response.ErrMalformedResponse, raw)
+	}
+}
@@ -0,0 +1,416 @@
+// Package proxy forwards requests to upstream servers through the client
+// package, streaming bodies both ways.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/shubh-man007/TinyProto/internal/client"
+	"github.com/shubh-man007/TinyProto/internal/headers"
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/shubh-man007/TinyProto/internal/server"
+)
+
+// hopHeaders describe a single connection, RFC 9110 section 7.6.1, and are
+// not forwarded in either direction. Expect was already answered by the
+// server.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"TE",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Expect",
+}
+
+var (
+	ErrNoUpstreams     = errors.New("error: reverse proxy needs at least one upstream")
+	ErrInvalidUpstream = errors.New("error: upstream must be an http or https URL without a query")
+)
+
+type upstream struct {
+	scheme string
+	host   string
+	path   string
+}
+
+// ReverseProxy forwards every request it serves to one of its upstreams,
+// taken in turn, and relays the response. Its Serve method is a
+// server.Handler. Upstream failures are answered with a 502, or a 504 when
+// the upstream timed out, and requests cut short by a server shutdown with a
+// 503.
+type ReverseProxy struct {
+	// Rewrite maps the path of an incoming request, decoded and with dot
+	// segments removed as the router matched it, to the one sent upstream.
+	// The result is escaped and appended to the upstream's own path. Nil
+	// forwards the path unchanged.
+	Rewrite func(path string) string
+	// Forwarded sends the client's address, protocol and host in an RFC 7239
+	// Forwarded header instead of X-Forwarded-For, -Proto and -Host.
+	Forwarded bool
+	// PreserveHost forwards the client's Host header instead of the
+	// upstream's host.
+	PreserveHost bool
+	// Timeout bounds the wait for an upstream's response headers. Zero means
+	// no limit.
+	Timeout time.Duration
+	// Client sends the requests upstream. Nil means a client that returns
+	// redirects as they are, for the downstream client to follow.
+	Client *client.Client
+
+	upstreams []upstream
+	next      atomic.Uint64
+}
+
+// New returns a proxy to upstreams, base URLs such as
+// "http://10.0.0.7:8080" or "https://api.internal/v2".
+func New(upstreams ...string) (*ReverseProxy, error) {
+	if len(upstreams) == 0 {
+		return nil, ErrNoUpstreams
+	}
+
+	p := &ReverseProxy{Client: &client.Client{CheckRedirect: client.NoRedirects}}
+	for _, raw := range upstreams {
+		target, err := request.ParseTarget("GET", raw)
+		if err != nil || target.Form != request.TargetAbsolute || target.RawQuery != "" ||
+			(target.Scheme != "http" && target.Scheme != "https") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidUpstream, raw)
+		}
+		p.upstreams = append(p.upstreams, upstream{
+			scheme: target.Scheme,
+			host:   target.Host,
+			path:   strings.TrimSuffix(target.RawPath, "/"),
+		})
+	}
+	return p, nil
+}
+
+// StripPrefix returns a Rewrite that removes prefix from the start of paths,
+// e.g. to serve an upstream's "/users" as "/api/users". The prefix only
+// matches whole segments: "/api" is stripped from "/api/users" but not from
+// "/apiary".
+func StripPrefix(prefix string) func(string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return func(path string) string {
+		if path == prefix {
+			return "/"
+		}
+		if strings.HasPrefix(path, prefix+"/") {
+			return path[len(prefix):]
+		}
+		return path
+	}
+}
+
+func (p *ReverseProxy) Serve(w *response.Writer, req *request.Request) {
+	if req.Target.Form == request.TargetAuthority || req.Target.Form == request.TargetAsterisk {
+		writeError(w, response.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	var timedOut atomic.Bool
+	var timer *time.Timer
+	if p.Timeout > 0 {
+		timer = time.AfterFunc(p.Timeout, func() {
+			timedOut.Store(true)
+			cancel()
+		})
+	}
+
+	res, err := p.roundTrip(ctx, req)
+	// The timeout covers the response headers only, the body streams for as
+	// long as both ends keep up.
+	if timer != nil && !timer.Stop() && err == nil {
+		res.Body.Close()
+		err = context.DeadlineExceeded
+	}
+	if err != nil {
+		cause := context.Cause(req.Context())
+		switch {
+		case errors.Is(cause, server.ErrClientGone):
+			// There is nobody to answer.
+		case errors.Is(cause, server.ErrServerClosed):
+			log.Printf("Proxying %s %s cut short by shutdown", req.RequestLine.Method, req.RequestLine.RequestTarget)
+			writeError(w, response.StatusServiceUnavailable)
+		case timedOut.Load() || isTimeout(err):
+			log.Printf("Proxying %s %s timed out", req.RequestLine.Method, req.RequestLine.RequestTarget)
+			writeError(w, response.StatusGatewayTimeout)
+		default:
+			log.Printf("Proxying %s %s failed: %v", req.RequestLine.Method, req.RequestLine.RequestTarget, err)
+			writeError(w, response.StatusBadGateway)
+		}
+		return
+	}
+	defer res.Body.Close()
+
+	p.copyResponse(w, req, res)
+}
+
+// roundTrip forwards req to the next upstream. A request without a body is
+// tried on the following upstreams when one cannot be reached.
+func (p *ReverseProxy) roundTrip(ctx context.Context, req *request.Request) (*response.Response, error) {
+	attempts := 1
+	if !hasBody(req) {
+		attempts = len(p.upstreams)
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		up := p.upstreams[(p.next.Add(1)-1)%uint64(len(p.upstreams))]
+		var out *request.Request
+		out, err = p.outRequest(ctx, req, up)
+		if err != nil {
+			return nil, err
+		}
+
+		var res *response.Response
+		res, err = p.Client.Do(out)
+		if err == nil {
+			return res, nil
+		}
+		var opErr *net.OpError
+		if !errors.As(err, &opErr) || opErr.Op != "dial" {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// outRequest builds the request sent to up: req's method, rewritten path,
+// query, end-to-end headers, body and trailers, plus forwarding headers.
+func (p *ReverseProxy) outRequest(ctx context.Context, req *request.Request, up upstream) (*request.Request, error) {
+	path := req.Target.Path
+	if p.Rewrite != nil {
+		path = p.Rewrite(path)
+	}
+	target := up.scheme + "://" + up.host + up.path + escapePath(path)
+	if req.Target.RawQuery != "" {
+		target += "?" + req.Target.RawQuery
+	}
+
+	out, err := request.NewRequest(ctx, req.RequestLine.Method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	copyHeaders(out.Header, req.Header)
+	if !p.PreserveHost {
+		out.Header.Delete("Host")
+	}
+
+	if hasBody(req) {
+		out.Body = req.Body
+		if len(req.Header.Values("Transfer-Encoding")) > 0 {
+			out.Header.Set("Transfer-Encoding", "chunked")
+			// Filled in by the server once the body has been read, which
+			// is when Write sends it.
+			out.Trailer = req.Trailer
+		}
+	}
+
+	p.addForwarded(out.Header, req)
+	return out, nil
+}
+
+// addForwarded records the client's address, the protocol and the host it
+// asked for, after what earlier proxies recorded.
+func (p *ReverseProxy) addForwarded(h *headers.Headers, req *request.Request) {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = ""
+	}
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	host := req.Header.Get("Host")
+
+	if p.Forwarded {
+		node := "unknown"
+		switch {
+		case strings.Contains(ip, ":"):
+			node = `"[` + ip + `]"`
+		case ip != "":
+			node = ip
+		}
+		elem := "for=" + node + ";proto=" + proto
+		if host != "" {
+			elem += ";host=" + quote(host)
+		}
+		h.Add("Forwarded", elem)
+		return
+	}
+
+	if ip != "" {
+		prior := strings.Join(h.Values("X-Forwarded-For"), ", ")
+		if prior != "" {
+			ip = prior + ", " + ip
+		}
+		h.Replace("X-Forwarded-For", ip)
+	}
+	h.Replace("X-Forwarded-Proto", proto)
+	if host != "" {
+		h.Replace("X-Forwarded-Host", host)
+	}
+}
+
+// escapePath percent-encodes the bytes of path that may not appear in a path
+// segment, RFC 3986 section 3.3, keeping its slashes.
+func escapePath(path string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if isPathChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+	return b.String()
+}
+
+func isPathChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("-._~!$&'()*+,;=:@/", c) >= 0
+}
+
+// quote makes s an RFC 7239 quoted-string, so that a Host holding quotes or
+// semicolons cannot add parameters of its own.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// copyResponse relays res to w. A body of known length keeps its
+// Content-Length, any other is sent chunked with the trailers res announced.
+func (p *ReverseProxy) copyResponse(w *response.Writer, req *request.Request, res *response.Response) {
+	h := headers.NewHeaders()
+	copyHeaders(h, res.Header)
+
+	code := res.StatusCode
+	noBody := req.RequestLine.Method == "HEAD" || code == response.StatusNoContent || code == response.StatusNotModified
+	chunked := !noBody && res.ContentLength < 0
+	if chunked {
+		h.Delete("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+	}
+
+	if err := w.WriteStatusLine(code); err != nil {
+		log.Printf("Error writing status line: %v", err)
+		return
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		log.Printf("Error writing headers: %v", err)
+		return
+	}
+	if noBody {
+		return
+	}
+
+	if !chunked {
+		if _, err := io.Copy(bodyWriter{w}, res.Body); err != nil {
+			log.Printf("Error relaying response body: %v", err)
+		}
+		return
+	}
+
+	trailers := headers.NewHeaders()
+	cw := w.ChunkedWriter(trailers)
+	if _, err := io.Copy(cw, res.Body); err != nil {
+		// Without the last chunk the client sees the body cut short.
+		log.Printf("Error relaying response body: %v", err)
+		return
+	}
+	for _, name := range res.Header.Tokens("Trailer") {
+		for _, value := range res.Trailer.Values(name) {
+			trailers.Add(name, value)
+		}
+	}
+	if err := cw.Close(); err != nil {
+		log.Printf("Error writing trailers: %v", err)
+	}
+}
+
+// bodyWriter adapts WriteBody to io.Writer.
+type bodyWriter struct {
+	w *response.Writer
+}
+
+func (bw bodyWriter) Write(p []byte) (int, error) {
+	return bw.w.WriteBody(p)
+}
+
+// copyHeaders adds the end-to-end fields of src to dst: all but the hop-by-hop
+// ones and those src's Connection header names.
+func copyHeaders(dst, src *headers.Headers) {
+	skip := map[string]bool{}
+	for _, name := range hopHeaders {
+		skip[strings.ToLower(name)] = true
+	}
+	for _, name := range src.Tokens("Connection") {
+		skip[strings.ToLower(name)] = true
+	}
+
+	for key, value := range src.Iter() {
+		if !skip[strings.ToLower(key)] {
+			dst.Add(key, value)
+		}
+	}
+}
+
+// hasBody reports whether req has a body to forward.
+func hasBody(req *request.Request) bool {
+	if len(req.Header.Values("Transfer-Encoding")) > 0 {
+		return true
+	}
+	cl := req.Header.Get("Content-Length")
+	return cl != "" && cl != "0"
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func writeError(w *response.Writer, code response.StatusCode) {
+	body := []byte(strconv.Itoa(int(code)) + " " + response.StatusText(code) + "\n")
+	if err := w.WriteStatusLine(code); err != nil {
+		log.Printf("Error writing status line: %v", err)
+		return
+	}
+	if err := w.WriteHeaders(response.GetDefaultHeaders(len(body))); err != nil {
+		log.Printf("Error writing headers: %v", err)
+		return
+	}
+	if _, err := w.WriteBody(body); err != nil {
+		log.Printf("Error writing body: %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shubh-man007/TinyProto/internal/client"
+	"github.com/shubh-man007/TinyProto/internal/headers"
+	"github.com/shubh-man007/TinyProto/internal/prototest"
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/shubh-man007/TinyProto/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backend returns a handler named name that answers /chunked by echoing the
+// request body and its X-Sum trailer in a chunked response with its own
+// trailer, /slow only once the request is cancelled, and anything else with
+// its name, the request target and the request headers.
+func backend(name string) func(*response.Writer, *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		switch req.Target.Path {
+		case "/chunked":
+			data, _ := io.ReadAll(req.Body)
+			h := headers.NewHeaders()
+			h.Set("Transfer-Encoding", "chunked")
+			h.Set("Trailer", "X-Echo")
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(h)
+			w.WriteChunk(data)
+			w.WriteChunk([]byte(" sum=" + req.Trailer.Get("X-Sum")))
+			trailers := headers.NewHeaders()
+			trailers.Set("X-Echo", "done")
+			w.WriteChunkedDone(trailers)
+
+		case "/slow":
+			select {
+			case <-req.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+
+		default:
+			var b strings.Builder
+			b.WriteString(name + " " + req.RequestLine.RequestTarget + "\n")
+			for key, value := range req.Header.Iter() {
+				b.WriteString(strings.ToLower(key) + ": " + value + "\n")
+			}
+			h := headers.NewHeaders()
+			h.Set("Content-Length", strconv.Itoa(b.Len()))
+			h.Set("Connection", "X-Internal")
+			h.Set("X-Internal", "secret")
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(h)
+			w.WriteBody([]byte(b.String()))
+		}
+	}
+}
+
+func newFront(t *testing.T, p *ReverseProxy) *prototest.Server {
+	t.Helper()
+	front := prototest.NewServer(p.Serve)
+	t.Cleanup(front.Close)
+	return front
+}
+
+func TestNew(t *testing.T) {
+	// Test: Upstreams are validated
+	_, err := New()
+	assert.ErrorIs(t, err, ErrNoUpstreams)
+	for _, raw := range []string{"/relative", "ftp://host/", "http://host/?q=1", "not a url"} {
+		_, err = New(raw)
+		assert.ErrorIs(t, err, ErrInvalidUpstream, raw)
+	}
+
+	p, err := New("http://a:8080/", "https://b/api/")
+	require.NoError(t, err)
+	assert.Equal(t, upstream{"http", "a:8080", ""}, p.upstreams[0])
+	assert.Equal(t, upstream{"https", "b", "/api"}, p.upstreams[1])
+
+	// Test: StripPrefix keeps paths absolute
+	strip := StripPrefix("/api")
+	assert.Equal(t, "/users", strip("/api/users"))
+	assert.Equal(t, "/", strip("/api"))
+	assert.Equal(t, "/other", strip("/other"))
+	assert.Equal(t, "/apiary", strip("/apiary"))
+	assert.Equal(t, "/users", StripPrefix("/api/")("/api/users"))
+}
+
+func TestReverseProxyHeaders(t *testing.T) {
+	up := prototest.NewServer(backend("a"))
+	defer up.Close()
+	p, err := New(up.URL)
+	require.NoError(t, err)
+	front := newFront(t, p)
+
+	// Test: Hop-by-hop fields are dropped and X-Forwarded-* added
+	res, err := front.Do("GET /users?id=7 HTTP/1.1\nHost: example.com\nConnection: X-Private\nX-Private: 1\nKeep-Alive: timeout=5\nTE: trailers\nX-Forwarded-For: 10.0.0.1\nX-Custom: kept\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusOK, res.Code)
+	body := string(res.Body)
+	assert.True(t, strings.HasPrefix(body, "a /users?id=7\n"), body)
+	assert.Contains(t, body, "host: "+up.Addr()+"\n")
+	assert.Contains(t, body, "x-custom: kept\n")
+	assert.Contains(t, body, "x-forwarded-for: 10.0.0.1, 127.0.0.1\n")
+	assert.Contains(t, body, "x-forwarded-proto: http\n")
+	assert.Contains(t, body, "x-forwarded-host: example.com\n")
+	assert.NotContains(t, body, "x-private")
+	assert.NotContains(t, body, "keep-alive")
+	assert.NotContains(t, body, "te:")
+
+	// Test: Hop-by-hop fields of the response are dropped too
+	assert.Empty(t, res.Header.Get("X-Internal"))
+
+	// Test: Forwarded replaces X-Forwarded-* and PreserveHost keeps Host
+	p.Forwarded = true
+	p.PreserveHost = true
+	res, err = front.Do("GET / HTTP/1.1\nHost: example.com:8080\nForwarded: for=10.0.0.1\n\n")
+	require.NoError(t, err)
+	body = string(res.Body)
+	assert.Contains(t, body, "host: example.com:8080\n")
+	assert.Contains(t, body, "forwarded: for=10.0.0.1\n")
+	assert.Contains(t, body, "forwarded: for=127.0.0.1;proto=http;host=\"example.com:8080\"\n")
+	assert.NotContains(t, body, "x-forwarded")
+
+	// Test: A Host with quotes cannot inject Forwarded parameters
+	res, err = front.Do("GET / HTTP/1.1\nHost: x\";for=6.6.6.6;by=\"y\n\n")
+	require.NoError(t, err)
+	assert.Contains(t, string(res.Body), `forwarded: for=127.0.0.1;proto=http;host="x\";for=6.6.6.6;by=\"y"`+"\n")
+
+	// Test: CONNECT cannot be proxied
+	res, err = front.Do("CONNECT example.com:443 HTTP/1.1\nHost: example.com:443\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusNotImplemented, res.Code)
+}
+
+func TestReverseProxyUpstreams(t *testing.T) {
+	a := prototest.NewServer(backend("a"))
+	defer a.Close()
+	b := prototest.NewServer(backend("b"))
+	defer b.Close()
+
+	// Test: Upstreams are taken in turn, and the path is rewritten
+	p, err := New(a.URL+"/v2", b.URL+"/v2")
+	require.NoError(t, err)
+	p.Rewrite = StripPrefix("/api")
+	front := newFront(t, p)
+
+	var got []string
+	for range 4 {
+		res, err := front.Do("GET /api/users HTTP/1.1\nHost: front\n\n")
+		require.NoError(t, err)
+		got = append(got, strings.SplitN(string(res.Body), "\n", 2)[0])
+	}
+	assert.Equal(t, []string{"a /v2/users", "b /v2/users", "a /v2/users", "b /v2/users"}, got)
+
+	// Test: Rewrite sees the path the router matched, and its result is escaped
+	for raw, want := range map[string]string{
+		"/x/../api/users": "/v2/users",
+		"/api/a%20b?q=1":  "/v2/a%20b?q=1",
+		"/api/%7Euser":    "/v2/~user",
+		"/apiary/hive":    "/v2/apiary/hive",
+	} {
+		res, err := front.Do("GET " + raw + " HTTP/1.1\nHost: front\n\n")
+		require.NoError(t, err)
+		line := strings.SplitN(string(res.Body), "\n", 2)[0]
+		assert.Equal(t, want, line[2:], raw)
+	}
+
+	// Test: An unreachable upstream is skipped for requests without a body
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dead := "http://" + l.Addr().String()
+	l.Close()
+
+	p, err = New(dead, a.URL)
+	require.NoError(t, err)
+	front = newFront(t, p)
+	for range 2 {
+		res, err := front.Do("GET /x HTTP/1.1\nHost: front\n\n")
+		require.NoError(t, err)
+		assert.Equal(t, response.StatusOK, res.Code)
+		assert.True(t, strings.HasPrefix(string(res.Body), "a /x\n"))
+	}
+
+	// Test: A request with a body to an unreachable upstream gets a 502
+	p, err = New(dead)
+	require.NoError(t, err)
+	front = newFront(t, p)
+	res, err := front.Do("POST /x HTTP/1.1\nHost: front\nContent-Length: 2\n\nhi")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusBadGateway, res.Code)
+}
+
+func TestReverseProxyStreaming(t *testing.T) {
+	up := prototest.NewServer(backend("a"))
+	defer up.Close()
+	p, err := New(up.URL)
+	require.NoError(t, err)
+	front := newFront(t, p)
+
+	// Test: Chunked bodies and trailers pass through both ways
+	res, err := front.Do("POST /chunked HTTP/1.1\r\nHost: front\r\nTransfer-Encoding: chunked\r\nTrailer: X-Sum\r\n\r\n" +
+		"5\r\nhello\r\n6\r\n world\r\n0\r\nX-Sum: 42\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusOK, res.Code)
+	assert.Equal(t, "chunked", res.Header.Get("Transfer-Encoding"))
+	assert.Equal(t, "hello world sum=42", string(res.Body))
+	assert.Equal(t, "done", res.Trailer.Get("X-Echo"))
+
+	// Test: HEAD responses keep their headers and have no body
+	head, err := request.NewRequest(context.Background(), "HEAD", front.URL+"/", nil)
+	require.NoError(t, err)
+	c := client.NewClient()
+	defer c.CloseIdleConnections()
+	hres, err := c.Do(head)
+	require.NoError(t, err)
+	defer hres.Body.Close()
+	assert.Equal(t, response.StatusOK, hres.StatusCode)
+	assert.NotEmpty(t, hres.Header.Get("Content-Length"))
+	data, err := io.ReadAll(hres.Body)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+func TestReverseProxyTimeout(t *testing.T) {
+	up := prototest.NewServer(backend("a"))
+	defer up.Close()
+	p, err := New(up.URL)
+	require.NoError(t, err)
+	p.Timeout = 200 * time.Millisecond
+	front := newFront(t, p)
+
+	// Test: An upstream that does not answer in time gets a 504
+	start := time.Now()
+	res, err := front.Do("GET /slow HTTP/1.1\nHost: front\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusGatewayTimeout, res.Code)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// Test: Fast upstreams are unaffected
+	res, err = front.Do("GET / HTTP/1.1\nHost: front\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusOK, res.Code)
+}
+
+func TestReverseProxyCancel(t *testing.T) {
+	up := prototest.NewServer(backend("a"))
+	defer up.Close()
+	p, err := New(up.URL)
+	require.NoError(t, err)
+
+	serve := func(cause error) *prototest.ResponseRecorder {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		req := prototest.NewRequest("GET /slow HTTP/1.1\nHost: front\n\n").WithContext(ctx)
+		time.AfterFunc(50*time.Millisecond, func() { cancel(cause) })
+		rec := prototest.NewRecorder()
+		p.Serve(rec.Writer, req)
+		return rec
+	}
+
+	// Test: A server shutting down answers 503
+	res, err := serve(server.ErrServerClosed).Result()
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusServiceUnavailable, res.Code)
+
+	// Test: Other cancellations answer 502
+	res, err = serve(context.Canceled).Result()
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusBadGateway, res.Code)
+
+	// Test: A client that went away gets nothing
+	assert.Empty(t, serve(server.ErrClientGone).Bytes())
+}
@@ -0,0 +1,146 @@
+package request
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// maxDrainBytes is how much of an unread body Close discards to keep the
+// connection usable. Past it the connection is given up instead.
+const maxDrainBytes = 256 << 10
+
+var (
+	// ErrBodyNotDrained is returned by Body.Close when too much of the body
+	// was left unread to discard it, so the stream cannot carry another
+	// request.
+	ErrBodyNotDrained = errors.New("error: request body left unread")
+
+	errBodyClosed = errors.New("error: read on closed request body")
+)
+
+// body streams the body of req off rr.
+type body struct {
+	rr   *Reader
+	req  *Request
+	err  error
+	done chan struct{}
+	once sync.Once
+}
+
+func newBody(rr *Reader, req *Request) *body {
+	b := &body{rr: rr, req: req, done: make(chan struct{})}
+	if req.state == stateDone {
+		b.finish(io.EOF)
+	}
+	return b
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	n, err := b.rr.readBody(b.req, p)
+	if err == nil && b.req.state == stateDone {
+		err = io.EOF
+	}
+	if err != nil {
+		b.finish(err)
+	}
+	return n, err
+}
+
+// Close discards whatever is left of the body, so the next request on the
+// stream can be read. It returns ErrBodyNotDrained if more than
+// maxDrainBytes were left, or the error that stopped the body short.
+func (b *body) Close() error {
+	if b.err == nil {
+		_, err := io.CopyN(io.Discard, b, maxDrainBytes+1)
+		if err == nil {
+			b.finish(ErrBodyNotDrained)
+		}
+	}
+
+	switch b.err {
+	case io.EOF, errBodyClosed:
+		b.err = errBodyClosed
+		return nil
+	}
+	return b.err
+}
+
+// finish makes err sticky and releases the stream for ReadAhead.
+func (b *body) finish(err error) {
+	b.err = err
+	b.once.Do(func() { close(b.done) })
+}
+
+// readBody reads body data of req into p, parsing chunk framing and trailers
+// on the way.
+func (rr *Reader) readBody(req *Request, p []byte) (int, error) {
+	for {
+		switch req.state {
+		case stateDone:
+			return 0, io.EOF
+
+		case requestStateParsingBodyData, requestStateParsingChunkData:
+			if len(p) > req.bodyRemaining {
+				p = p[:req.bodyRemaining]
+			}
+
+			var n int
+			if rr.readToIndex > 0 {
+				n = copy(p, rr.buff[:rr.readToIndex])
+				copy(rr.buff, rr.buff[n:rr.readToIndex])
+				rr.readToIndex -= n
+			} else {
+				if rr.eof {
+					return 0, io.ErrUnexpectedEOF
+				}
+				// Nothing buffered, read straight into the caller's slice.
+				var err error
+				n, err = rr.reader.Read(p)
+				if err == io.EOF {
+					rr.eof = true
+				} else if err != nil {
+					return n, err
+				}
+			}
+
+			req.bodyRemaining -= n
+			req.bodyBytes += n
+			if req.bodyRemaining == 0 {
+				if req.state == requestStateParsingBodyData {
+					req.state = stateDone
+				} else {
+					req.state = requestStateParsingChunkEnd
+				}
+			}
+			if n > 0 {
+				return n, nil
+			}
+
+		default:
+			err := rr.parse(req, func() bool {
+				switch req.state {
+				case stateDone, requestStateParsingBodyData, requestStateParsingChunkData:
+					return true
+				}
+				return false
+			})
+			if err != nil {
+				return 0, err
+			}
+			// parse stops early only when the stream ended.
+			switch req.state {
+			case stateDone, requestStateParsingBodyData, requestStateParsingChunkData:
+			default:
+				return 0, io.ErrUnexpectedEOF
+			}
+		}
+	}
+}
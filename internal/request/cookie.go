@@ -0,0 +1,29 @@
+package request
+
+import (
+	"errors"
+
+	"github.com/shubh-man007/TinyProto/internal/cookie"
+)
+
+var ErrNoCookie = errors.New("error: named cookie not present")
+
+// Cookies returns the cookies sent in the request's Cookie header lines, in
+// order. Malformed pairs are skipped.
+func (r *Request) Cookies() []*cookie.Cookie {
+	var cookies []*cookie.Cookie
+	for _, line := range r.Header.Values("Cookie") {
+		cookies = append(cookies, cookie.Parse(line)...)
+	}
+	return cookies
+}
+
+// Cookie returns the first cookie with the given name, or ErrNoCookie.
+func (r *Request) Cookie(name string) (*cookie.Cookie, error) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, ErrNoCookie
+}
@@ -0,0 +1,35 @@
+package request
+
+// ParseError is an error that stops a request from being parsed. Status is
+// the code a server should answer with. The message names the cause for
+// logs and is not meant to be sent to clients.
+type ParseError struct {
+	Status int
+	msg    string
+}
+
+func (e *ParseError) Error() string {
+	return e.msg
+}
+
+func newParseError(status int, msg string) *ParseError {
+	return &ParseError{Status: status, msg: msg}
+}
+
+// Statuses carried by parse errors, matching the response package's.
+const (
+	statusBadRequest              = 400
+	statusContentTooLarge         = 413
+	statusHeaderFieldsTooLarge    = 431
+	statusNotImplemented          = 501
+	statusHTTPVersionNotSupported = 505
+)
+
+var (
+	ErrMalformedRequestLine        = newParseError(statusBadRequest, "error: malformed request line")
+	ErrInvalidVersion              = newParseError(statusBadRequest, "error: invalid HTTP version")
+	ErrInvalidHeader               = newParseError(statusBadRequest, "error: invalid header field")
+	ErrAmbiguousFraming            = newParseError(statusBadRequest, "error: ambiguous message framing")
+	ErrMalformedChunk              = newParseError(statusBadRequest, "error: malformed chunked body")
+	ErrUnsupportedTransferEncoding = newParseError(statusNotImplemented, "error: unsupported transfer encoding")
+)
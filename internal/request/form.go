@@ -0,0 +1,133 @@
+package request
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrNotMultipart       = errors.New("error: request Content-Type is not multipart/form-data")
+	ErrMissingBoundary    = errors.New("error: multipart Content-Type has no boundary")
+	ErrMalformedMediaType = errors.New("error: malformed media type parameters")
+)
+
+// bodyReader returns a reader over the request body.
+func (r *Request) bodyReader() io.Reader {
+	if r.Body == nil {
+		return strings.NewReader("")
+	}
+	return r.Body
+}
+
+// ParseForm fills Form with the query parameters and, for a body sent as
+// application/x-www-form-urlencoded, PostForm with the body's values. Body
+// values come first in Form. It is a no-op if the form was already parsed.
+func (r *Request) ParseForm() error {
+	if r.PostForm == nil {
+		r.PostForm = Query{}
+		mediaType, _, err := parseMediaType(r.Header.Get("Content-Type"))
+		if err == nil && mediaType == "application/x-www-form-urlencoded" {
+			body, err := io.ReadAll(r.bodyReader())
+			if err != nil {
+				return err
+			}
+			if r.PostForm, err = ParseQuery(string(body)); err != nil {
+				r.PostForm = nil
+				return err
+			}
+		}
+	}
+
+	if r.Form == nil {
+		r.Form = Query{}
+		for key, values := range r.PostForm {
+			r.Form[key] = append(r.Form[key], values...)
+		}
+		for key, values := range r.Target.Query {
+			r.Form[key] = append(r.Form[key], values...)
+		}
+	}
+	return nil
+}
+
+// FormValue returns the first value of key from the query or the body,
+// parsing a urlencoded or multipart form with default limits if needed.
+// Parse errors are ignored; call ParseForm or ParseMultipartForm to see them.
+func (r *Request) FormValue(key string) string {
+	if r.Form == nil {
+		r.ParseForm()
+		r.ParseMultipartForm(MultipartLimits{})
+	}
+	return r.Form.Get(key)
+}
+
+// FormFile opens the first file uploaded under key, parsing the multipart
+// form with default limits if needed.
+func (r *Request) FormFile(key string) (io.ReadCloser, *FileHeader, error) {
+	if r.MultipartForm == nil {
+		if err := r.ParseMultipartForm(MultipartLimits{}); err != nil {
+			return nil, nil, err
+		}
+	}
+	files := r.MultipartForm.File[key]
+	if len(files) == 0 {
+		return nil, nil, errors.New("error: no such file in form")
+	}
+	f, err := files[0].Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, files[0], nil
+}
+
+// parseMediaType splits a Content-Type or Content-Disposition value into its
+// lower-cased type and its parameters. Parameter names are lower-cased and
+// quoted values unescaped.
+func parseMediaType(v string) (string, map[string]string, error) {
+	mediaType, rest, _ := strings.Cut(v, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	params := map[string]string{}
+
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		name, after, ok := strings.Cut(rest, "=")
+		if !ok {
+			return "", nil, ErrMalformedMediaType
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		after = strings.TrimLeft(after, " \t")
+
+		var value string
+		if strings.HasPrefix(after, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(after) && after[i] != '"'; i++ {
+				if after[i] == '\\' && i+1 < len(after) {
+					i++
+				}
+				b.WriteByte(after[i])
+			}
+			if i == len(after) {
+				return "", nil, ErrMalformedMediaType
+			}
+			value = b.String()
+			after = after[i+1:]
+		} else if idx := strings.IndexByte(after, ';'); idx != -1 {
+			value, after = strings.TrimSpace(after[:idx]), after[idx:]
+		} else {
+			value, after = strings.TrimSpace(after), ""
+		}
+
+		if name == "" {
+			return "", nil, ErrMalformedMediaType
+		}
+		params[name] = value
+
+		after = strings.TrimSpace(after)
+		if after != "" && after[0] != ';' {
+			return "", nil, ErrMalformedMediaType
+		}
+		rest = strings.TrimPrefix(after, ";")
+	}
+	return mediaType, params, nil
+}
@@ -0,0 +1,396 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/shubh-man007/TinyProto/internal/headers"
+)
+
+const (
+	DefaultMultipartMaxMemory = 32 << 20
+	DefaultMultipartMaxParts  = 1000
+	DefaultMultipartMaxBytes  = 64 << 20
+)
+
+// maxPartHeaderBytes bounds the header section of a single part.
+const maxPartHeaderBytes = 16 << 10
+
+var (
+	ErrTooManyParts       = errors.New("error: multipart form has too many parts")
+	ErrMultipartTooLarge  = errors.New("error: multipart form too large")
+	ErrMalformedMultipart = errors.New("error: malformed multipart body")
+)
+
+// MultipartLimits bounds what ParseMultipartForm accepts. Zero fields take the
+// package defaults.
+type MultipartLimits struct {
+	// MaxMemory is how many bytes of part content are kept in memory. File
+	// parts past it are spilled to temporary files; value parts past it are
+	// an error.
+	MaxMemory int64
+	// MaxParts caps the number of parts.
+	MaxParts int
+	// MaxBytes caps the size of the whole multipart body.
+	MaxBytes int64
+}
+
+func (l MultipartLimits) withDefaults() MultipartLimits {
+	if l.MaxMemory <= 0 {
+		l.MaxMemory = DefaultMultipartMaxMemory
+	}
+	if l.MaxParts <= 0 {
+		l.MaxParts = DefaultMultipartMaxParts
+	}
+	if l.MaxBytes <= 0 {
+		l.MaxBytes = DefaultMultipartMaxBytes
+	}
+	return l
+}
+
+// MultipartForm is a parsed multipart/form-data body.
+type MultipartForm struct {
+	Value Query
+	File  map[string][]*FileHeader
+}
+
+// RemoveAll deletes the temporary files backing spilled file parts.
+func (f *MultipartForm) RemoveAll() error {
+	var err error
+	for _, files := range f.File {
+		for _, fh := range files {
+			if fh.tmpfile == "" {
+				continue
+			}
+			if rerr := os.Remove(fh.tmpfile); rerr != nil && err == nil {
+				err = rerr
+			}
+		}
+	}
+	return err
+}
+
+// FileHeader describes an uploaded file part.
+type FileHeader struct {
+	Filename string
+	Header   *headers.Headers
+	Size     int64
+
+	content []byte
+	tmpfile string
+}
+
+// Open returns a reader over the file's content, wherever it is stored.
+func (fh *FileHeader) Open() (io.ReadCloser, error) {
+	if fh.tmpfile != "" {
+		return os.Open(fh.tmpfile)
+	}
+	return io.NopCloser(bytes.NewReader(fh.content)), nil
+}
+
+// ParseMultipartForm parses a multipart/form-data body into MultipartForm,
+// streaming it part by part. Value parts are also added to Form and
+// PostForm. Callers should call MultipartForm.RemoveAll once done with the
+// files. It is a no-op if the form was already parsed.
+func (r *Request) ParseMultipartForm(limits MultipartLimits) error {
+	if r.MultipartForm != nil {
+		return nil
+	}
+
+	mediaType, params, err := parseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return ErrNotMultipart
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return ErrMissingBoundary
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+
+	form, err := readMultipartForm(r.bodyReader(), boundary, limits.withDefaults())
+	if err != nil {
+		return err
+	}
+
+	r.MultipartForm = form
+	for key, values := range form.Value {
+		r.PostForm[key] = append(r.PostForm[key], values...)
+		r.Form[key] = append(r.Form[key], values...)
+	}
+	return nil
+}
+
+func readMultipartForm(body io.Reader, boundary string, limits MultipartLimits) (*MultipartForm, error) {
+	form := &MultipartForm{
+		Value: Query{},
+		File:  map[string][]*FileHeader{},
+	}
+	mr := newMultipartReader(&capReader{r: body, remaining: limits.MaxBytes}, boundary)
+	memLeft := limits.MaxMemory
+
+	fail := func(err error) (*MultipartForm, error) {
+		form.RemoveAll()
+		return nil, err
+	}
+
+	if err := mr.skipPreamble(); err != nil {
+		return fail(err)
+	}
+
+	for parts := 0; !mr.done; parts++ {
+		if parts == limits.MaxParts {
+			return fail(ErrTooManyParts)
+		}
+
+		h, err := mr.readPartHeader()
+		if err != nil {
+			return fail(err)
+		}
+
+		_, params, err := parseMediaType(h.Get("Content-Disposition"))
+		if err != nil {
+			return fail(ErrMalformedMultipart)
+		}
+		name := params["name"]
+		filename, isFile := params["filename"]
+
+		if !isFile {
+			var value bytes.Buffer
+			n, err := mr.copyPart(&value)
+			if err != nil {
+				return fail(err)
+			}
+			if memLeft -= n; memLeft < 0 {
+				return fail(ErrMultipartTooLarge)
+			}
+			if name != "" {
+				form.Value[name] = append(form.Value[name], value.String())
+			}
+			continue
+		}
+
+		sb := &spillBuffer{limit: memLeft}
+		n, err := mr.copyPart(sb)
+		if sb.file != nil {
+			sb.file.Close()
+		}
+		if err != nil {
+			if sb.file != nil {
+				os.Remove(sb.file.Name())
+			}
+			return fail(err)
+		}
+
+		fh := &FileHeader{Filename: filename, Header: h, Size: n}
+		if sb.file != nil {
+			fh.tmpfile = sb.file.Name()
+		} else {
+			fh.content = sb.mem.Bytes()
+			memLeft -= n
+		}
+		if name != "" {
+			form.File[name] = append(form.File[name], fh)
+		} else if fh.tmpfile != "" {
+			os.Remove(fh.tmpfile)
+		}
+	}
+
+	return form, nil
+}
+
+// capReader fails with ErrMultipartTooLarge once more than remaining bytes
+// are read.
+type capReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (cr *capReader) Read(p []byte) (int, error) {
+	if cr.remaining <= 0 {
+		// Only an immediate end of stream is within the limit.
+		n, err := cr.r.Read(make([]byte, 1))
+		if n > 0 {
+			return 0, ErrMultipartTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > cr.remaining {
+		p = p[:cr.remaining]
+	}
+	n, err := cr.r.Read(p)
+	cr.remaining -= int64(n)
+	return n, err
+}
+
+// spillBuffer keeps up to limit bytes in memory and moves everything to a
+// temporary file past that.
+type spillBuffer struct {
+	mem   bytes.Buffer
+	limit int64
+	file  *os.File
+}
+
+func (sb *spillBuffer) Write(p []byte) (int, error) {
+	if sb.file == nil && int64(sb.mem.Len()+len(p)) > sb.limit {
+		f, err := os.CreateTemp("", "tinyproto-multipart-")
+		if err != nil {
+			return 0, err
+		}
+		if _, err := f.Write(sb.mem.Bytes()); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return 0, err
+		}
+		sb.mem = bytes.Buffer{}
+		sb.file = f
+	}
+	if sb.file != nil {
+		return sb.file.Write(p)
+	}
+	return sb.mem.Write(p)
+}
+
+// multipartReader walks the parts of a multipart body without holding more
+// than its buffer in memory.
+type multipartReader struct {
+	br       *bufio.Reader
+	boundary []byte // "--" + boundary
+	delim    []byte // CRLF + "--" + boundary
+	done     bool
+}
+
+func newMultipartReader(r io.Reader, boundary string) *multipartReader {
+	delim := []byte(CRLF + "--" + boundary)
+	size := 4096
+	if 2*len(delim) > size {
+		size = 2 * len(delim)
+	}
+	return &multipartReader{
+		br:       bufio.NewReaderSize(r, size),
+		boundary: delim[len(CRLF):],
+		delim:    delim,
+	}
+}
+
+// skipPreamble discards everything up to and including the first boundary
+// line.
+func (mr *multipartReader) skipPreamble() error {
+	for {
+		line, err := mr.br.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull {
+			if err == io.EOF {
+				return ErrMalformedMultipart
+			}
+			return err
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		line = bytes.TrimRight(line, " \t\r\n")
+		if bytes.Equal(line, mr.boundary) {
+			return nil
+		}
+		if bytes.HasPrefix(line, mr.boundary) && bytes.Equal(line[len(mr.boundary):], []byte("--")) {
+			mr.done = true
+			return nil
+		}
+	}
+}
+
+// readPartHeader reads the header section of the next part.
+func (mr *multipartReader) readPartHeader() (*headers.Headers, error) {
+	var raw []byte
+	for {
+		line, err := mr.br.ReadSlice('\n')
+		raw = append(raw, line...)
+		if len(raw) > maxPartHeaderBytes {
+			return nil, ErrMalformedMultipart
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil, ErrMalformedMultipart
+			}
+			return nil, err
+		}
+		if bytes.HasSuffix(raw, []byte(CRLF+CRLF)) || bytes.Equal(raw, []byte(CRLF)) {
+			break
+		}
+	}
+
+	h := headers.NewHeaders()
+	if _, done, err := h.Parse(raw); err != nil || !done {
+		return nil, ErrMalformedMultipart
+	}
+	return h, nil
+}
+
+// copyPart copies the content of the current part to dst, consuming the
+// boundary that ends it.
+func (mr *multipartReader) copyPart(dst io.Writer) (int64, error) {
+	var total int64
+	for {
+		buf, err := mr.br.Peek(mr.br.Size())
+		if idx := bytes.Index(buf, mr.delim); idx != -1 {
+			n, werr := dst.Write(buf[:idx])
+			total += int64(n)
+			if werr != nil {
+				return total, werr
+			}
+			mr.br.Discard(idx + len(mr.delim))
+			return total, mr.afterBoundary()
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			if err == io.EOF {
+				return total, ErrMalformedMultipart
+			}
+			return total, err
+		}
+
+		// Hold back enough bytes to catch a delimiter split across reads.
+		safe := len(buf) - len(mr.delim) + 1
+		n, werr := dst.Write(buf[:safe])
+		total += int64(n)
+		if werr != nil {
+			return total, werr
+		}
+		mr.br.Discard(safe)
+	}
+}
+
+// afterBoundary reads what follows a boundary: "--" for the last one, or
+// optional whitespace and CRLF before the next part.
+func (mr *multipartReader) afterBoundary() error {
+	next, err := mr.br.Peek(2)
+	if err != nil {
+		if err == io.EOF {
+			return ErrMalformedMultipart
+		}
+		return err
+	}
+	if bytes.Equal(next, []byte("--")) {
+		mr.done = true
+		return nil
+	}
+
+	line, err := mr.br.ReadSlice('\n')
+	if err != nil {
+		if err == io.EOF || err == bufio.ErrBufferFull {
+			return ErrMalformedMultipart
+		}
+		return err
+	}
+	if len(bytes.TrimRight(line, " \t\r\n")) != 0 || !bytes.HasSuffix(line, []byte(CRLF)) {
+		return ErrMalformedMultipart
+	}
+	return nil
+}
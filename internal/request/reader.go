@@ -0,0 +1,246 @@
+package request
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/shubh-man007/TinyProto/internal/headers"
+)
+
+// Reader parses consecutive requests off a single stream. Bytes read past the
+// end of one request are kept and used as the start of the next one.
+type Reader struct {
+	// MaxHeaderBytes caps the combined size of the request line, headers and
+	// trailers. Zero means no limit.
+	MaxHeaderBytes int
+	// MaxBodyBytes caps the size of a request body. Zero means no limit.
+	MaxBodyBytes int
+	// Strict rejects the ambiguities that let a proxy and this server
+	// disagree on message boundaries: extra whitespace or bare line breaks
+	// in the request line, methods that are not uppercase letters, a
+	// missing, repeated or malformed Host, repeated or non-numeric
+	// Content-Length, and whitespace before a colon or folded lines in the
+	// field section. Each has its own error.
+	Strict bool
+
+	reader      io.Reader
+	buff        []byte
+	readToIndex int //bytes till which buff is filled
+	eof         bool
+	body        *body // body of the last request, nil before the first
+}
+
+func NewReader(reader io.Reader) *Reader {
+	const buffSize = 8
+	return &Reader{
+		reader: reader,
+		buff:   make([]byte, buffSize),
+	}
+}
+
+// Buffered returns the number of bytes read from the stream that have not
+// been consumed by a request yet.
+func (rr *Reader) Buffered() int {
+	return rr.readToIndex
+}
+
+// WaitForRequest blocks until at least one byte of the next request is
+// available, discarding what is left of the previous body first. It returns
+// io.EOF if the stream ends first.
+func (rr *Reader) WaitForRequest() error {
+	if err := rr.discardBody(); err != nil {
+		return err
+	}
+	for rr.readToIndex == 0 {
+		if rr.eof {
+			return io.EOF
+		}
+		if err := rr.fill(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadAhead performs a single read from the stream into the buffer, so that
+// a server can notice the client going away while a handler runs. Bytes read
+// are kept for the next request. It returns io.EOF once the stream has ended.
+// It must not be called before BodyDone is closed.
+func (rr *Reader) ReadAhead() error {
+	if rr.eof {
+		return io.EOF
+	}
+	if err := rr.fill(); err != nil {
+		return err
+	}
+	if rr.eof {
+		return io.EOF
+	}
+	return nil
+}
+
+// ReadRequest parses the next request from the stream and reads its body into
+// memory. It returns io.EOF if the stream ends cleanly before any byte of a
+// new request arrives.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	req, err := rr.ReadRequestHeader()
+	if err != nil {
+		return nil, err
+	}
+	if err := rr.ReadBody(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ReadRequestHeader parses the request line and headers of the next request,
+// and checks its body framing. The body is left on the stream, to be read
+// through req.Body; what the caller does not read is discarded before the
+// next request.
+func (rr *Reader) ReadRequestHeader() (*Request, error) {
+	if err := rr.discardBody(); err != nil {
+		return nil, err
+	}
+
+	req := &Request{
+		state:        stateInitialized,
+		Header:       headers.NewHeaders(),
+		Trailer:      headers.NewHeaders(),
+		maxBodyBytes: rr.MaxBodyBytes,
+		strict:       rr.Strict,
+	}
+
+	err := rr.parse(req, func() bool {
+		switch req.state {
+		case stateInitialized, requestStateParsingHeaders, requestStateParsingBody:
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The stream ended inside the headers, take what arrived as a request
+	// without a body.
+	if req.state == requestStateParsingHeaders {
+		req.state = stateDone
+	}
+
+	rr.body = newBody(rr, req)
+	req.Body = rr.body
+	return req, nil
+}
+
+// ReadBody reads the body of req, returned by ReadRequestHeader, into memory
+// and replaces req.Body with the buffered copy. req.Trailer is filled too.
+func (rr *Reader) ReadBody(req *Request) error {
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return nil
+}
+
+// BodyDone returns a channel that is closed once the body of the last request
+// has been read to its end, has failed or has been closed. Until then the
+// stream belongs to the body.
+func (rr *Reader) BodyDone() <-chan struct{} {
+	if rr.body == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return rr.body.done
+}
+
+// discardBody drains what is left of the last request's body.
+func (rr *Reader) discardBody() error {
+	if rr.body == nil {
+		return nil
+	}
+	return rr.body.Close()
+}
+
+// inHeaderSection reports whether state parses a part of the message that
+// counts towards MaxHeaderBytes.
+func inHeaderSection(state int) bool {
+	switch state {
+	case stateInitialized, requestStateParsingHeaders, requestStateParsingTrailers:
+		return true
+	}
+	return false
+}
+
+// parse feeds buffered and newly read bytes to req until done reports true.
+func (rr *Reader) parse(req *Request, done func() bool) error {
+	for !done() {
+		// parse whatever we already have.
+		if rr.readToIndex > 0 || req.state != stateInitialized {
+			prevState := req.state
+			consumed, err := req.Parse(rr.buff[:rr.readToIndex])
+			if err != nil {
+				return err
+			}
+			if inHeaderSection(prevState) {
+				req.headerBytes += consumed
+			}
+			if consumed > 0 || req.state != prevState {
+				copy(rr.buff, rr.buff[consumed:rr.readToIndex])
+				rr.readToIndex -= consumed
+				// attempt parsing again before reading more.
+				continue
+			}
+			if req.state == stateDone {
+				break
+			}
+		}
+
+		if rr.eof {
+			if rr.readToIndex == 0 && req.state == stateInitialized {
+				return io.EOF
+			}
+			if req.state == stateInitialized {
+				return io.ErrUnexpectedEOF
+			}
+			break
+		}
+
+		// Whatever is buffered now is an incomplete line, so it will end up
+		// part of the header section too.
+		if rr.MaxHeaderBytes > 0 && inHeaderSection(req.state) &&
+			req.headerBytes+rr.readToIndex >= rr.MaxHeaderBytes {
+			return ErrHeaderTooLarge
+		}
+
+		if err := rr.fill(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fill reads more bytes from the stream into the buffer, growing it when
+// full. Reaching the end of the stream is recorded rather than returned so
+// that buffered bytes can still be parsed.
+func (rr *Reader) fill() error {
+	if rr.readToIndex == len(rr.buff) {
+		newBuff := make([]byte, len(rr.buff)*2)
+		copy(newBuff, rr.buff)
+		rr.buff = newBuff
+	}
+
+	n, err := rr.reader.Read(rr.buff[rr.readToIndex:])
+	rr.readToIndex += n
+	if err != nil {
+		if err != io.EOF {
+			return err
+		}
+		rr.eof = true
+	}
+	return nil
+}
+
+func RequestFromReader(reader io.Reader) (*Request, error) {
+	return NewReader(reader).ReadRequest()
+}
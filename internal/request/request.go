@@ -1,7 +1,11 @@
 package request
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
@@ -17,15 +21,67 @@ const (
 	stateDone
 	requestStateParsingHeaders
 	requestStateParsingBody
+	requestStateParsingBodyData
+	requestStateParsingChunkSize
+	requestStateParsingChunkData
+	requestStateParsingChunkEnd
+	requestStateParsingTrailers
 )
 
 type Request struct {
 	RequestLine RequestLine
 	state       int
 	Header      *headers.Headers
-	Body        []byte
+	// Body streams the request body off the connection, following its
+	// Content-Length or chunked framing. It is never nil; a request without a
+	// body reads as empty.
+	Body io.ReadCloser
+	// Trailer holds the fields sent after the last chunk of a chunked body.
+	// It is filled once Body has been read to its end.
+	Trailer *headers.Headers
+	// Target is RequestLine.RequestTarget parsed into path and query.
+	Target Target
+	// Form holds the query parameters followed by the body's form values,
+	// PostForm the body's values alone. Both are set by ParseForm.
+	Form     Query
+	PostForm Query
+	// MultipartForm is set by ParseMultipartForm.
+	MultipartForm *MultipartForm
+	// TLS holds the negotiated version, cipher suite and client certificates
+	// of an HTTPS connection. It is nil for plain HTTP.
+	TLS *tls.ConnectionState
+	// RemoteAddr is the address of the client the request came from, set by
+	// the server.
+	RemoteAddr string
+	// GetBody returns a fresh copy of Body, for a client to send the body
+	// again after a redirect. NewRequest sets it for bodies it can replay.
+	GetBody func() (io.ReadCloser, error)
+
+	bodyRemaining int
+	bodyBytes     int
+	pathParams    map[string]string
+	headerBytes   int
+	maxBodyBytes  int
+	strict        bool
+	ctx           context.Context
 }
 
+var (
+	// ErrHeaderTooLarge is returned when the request line and headers, or
+	// the trailers, exceed the reader's MaxHeaderBytes.
+	ErrHeaderTooLarge = newParseError(statusHeaderFieldsTooLarge, "error: request header too large")
+	// ErrBodyTooLarge is returned when the body exceeds the reader's
+	// MaxBodyBytes.
+	ErrBodyTooLarge = newParseError(statusContentTooLarge, "error: request body too large")
+	// ErrVersionNotSupported is returned for a well-formed HTTP version with
+	// a major version other than 1.
+	ErrVersionNotSupported = newParseError(statusHTTPVersionNotSupported, "error: unsupported HTTP version")
+)
+
+// maxChunkSizeLine bounds the length of a chunk-size line including its
+// extensions.
+const maxChunkSizeLine = 4096
+
 type RequestLine struct {
 	HttpVersion   string
 	RequestTarget string
@@ -53,17 +109,20 @@ func parseRequestLine(request string) (RequestLine, int, error) {
 	if len(elements) == 3 {
 		// Validate HTTP method:
 		if !IsUpper(elements[0]) {
-			return RequestLine{}, idx, errors.New("invalid HTTP method, must be uppercase")
+			return RequestLine{}, idx, fmt.Errorf("%w: %q is not uppercase", ErrInvalidMethod, elements[0])
 		}
 
 		// Validate HTTP version
 		if !strings.HasPrefix(elements[2], "HTTP/") {
-			return RequestLine{}, idx, errors.New("invalid HTTP version format")
+			return RequestLine{}, idx, fmt.Errorf("%w: %q", ErrInvalidVersion, elements[2])
 		}
 
 		version := strings.TrimPrefix(elements[2], "HTTP/")
-		if version != "1.1" {
-			return RequestLine{}, idx, errors.New("unsupported HTTP version, only 1.1 is allowed")
+		if len(version) != 3 || !isDigit(version[0]) || version[1] != '.' || !isDigit(version[2]) {
+			return RequestLine{}, idx, fmt.Errorf("%w: %q", ErrInvalidVersion, elements[2])
+		}
+		if version[0] != '1' {
+			return RequestLine{}, idx, ErrVersionNotSupported
 		}
 
 		reqStruct := RequestLine{}
@@ -75,13 +134,22 @@ func parseRequestLine(request string) (RequestLine, int, error) {
 		return reqStruct, idx, nil
 	}
 
-	return RequestLine{}, idx, errors.New("failed to parse request line: Incomplete request line")
+	return RequestLine{}, idx, fmt.Errorf("%w: %d parts instead of 3", ErrMalformedRequestLine, len(elements))
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
 }
 
 func (r *Request) Parse(data []byte) (int, error) {
 	switch r.state {
 	case stateInitialized:
 		reqLine, n, err := parseRequestLine(string(data))
+		if r.strict && n > 0 {
+			if err := checkStrictRequestLine(string(data[:n])); err != nil {
+				return 0, err
+			}
+		}
 		if err != nil {
 			return 0, err
 		}
@@ -90,49 +158,133 @@ func (r *Request) Parse(data []byte) (int, error) {
 			return 0, nil
 		}
 
+		target, err := ParseTarget(reqLine.Method, reqLine.RequestTarget)
+		if err != nil {
+			return 0, err
+		}
+
 		consumed := n + len("\r\n")
 		r.RequestLine = reqLine
+		r.Target = target
 		r.state = requestStateParsingHeaders
 		return consumed, nil
 
 	case requestStateParsingHeaders:
-		n, done, err := r.Header.Parse(data)
+		n, done, err := r.parseFields(r.Header, data)
 		if err != nil {
 			return 0, err
 		}
 
 		if done {
+			if r.strict {
+				if err := r.checkStrictHeaders(); err != nil {
+					return 0, err
+				}
+			}
 			r.state = requestStateParsingBody
 		}
 
 		return n, nil
 
 	case requestStateParsingBody:
-		CLVal := r.Header.Get("Content-Length")
-		if CLVal == "" {
+		CLVals := r.Header.Values("Content-Length")
+		codings := r.Header.Tokens("Transfer-Encoding")
+		if len(r.Header.Values("Transfer-Encoding")) > 0 {
+			// HTTP/1.0 has no chunked framing, a 1.0 message claiming it
+			// cannot be delimited.
+			if !r.ProtoAtLeast(1, 1) {
+				return 0, fmt.Errorf("%w: Transfer-Encoding in an HTTP/1.0 request", ErrAmbiguousFraming)
+			}
+			// A message with both is ambiguous about where its body ends.
+			if len(CLVals) > 0 {
+				return 0, fmt.Errorf("%w: both Content-Length and Transfer-Encoding present", ErrAmbiguousFraming)
+			}
+			if len(codings) != 1 || !strings.EqualFold(codings[0], "chunked") {
+				return 0, fmt.Errorf("%w: %q", ErrUnsupportedTransferEncoding, r.Header.Values("Transfer-Encoding"))
+			}
+			r.state = requestStateParsingChunkSize
+			return 0, nil
+		}
+
+		if len(CLVals) == 0 {
 			r.state = stateDone
 			return 0, nil
 		}
 
-		r.Body = append(r.Body, data...)
+		// Repeated Content-Length lines are only acceptable if they agree.
+		CLVal := CLVals[0]
+		for _, v := range CLVals[1:] {
+			if v != CLVal {
+				return 0, fmt.Errorf("%w: conflicting values %q and %q", ErrInvalidContentLength, CLVal, v)
+			}
+		}
+
+		length, err := ParseContentLength(CLVal)
+		if err != nil {
+			return 0, err
+		}
+		if r.maxBodyBytes > 0 && length > int64(r.maxBodyBytes) {
+			return 0, ErrBodyTooLarge
+		}
+		CLInt := int(length)
 
-		CLInt, err := strconv.Atoi(CLVal)
+		if CLInt == 0 {
+			r.state = stateDone
+			return 0, nil
+		}
+		r.bodyRemaining = CLInt
+		r.state = requestStateParsingBodyData
+		return 0, nil
+
+	case requestStateParsingBodyData, requestStateParsingChunkData:
+		return 0, errors.New("error: body data is read through Body")
+
+	case requestStateParsingChunkSize:
+		idx := bytes.Index(data, []byte(CRLF))
+		if idx == -1 {
+			if len(data) > maxChunkSizeLine {
+				return 0, fmt.Errorf("%w: chunk size line too long", ErrMalformedChunk)
+			}
+			return 0, nil
+		}
+
+		size, err := ParseChunkSize(string(data[:idx]))
 		if err != nil {
-			return 0, errors.New("error: invalid content length value")
+			return 0, err
+		}
+		if r.maxBodyBytes > 0 && r.bodyBytes+size > r.maxBodyBytes {
+			return 0, ErrBodyTooLarge
 		}
 
-		if len(r.Body) > CLInt {
-			return 0, errors.New("error: body length greater than header specified value")
+		if size == 0 {
+			r.state = requestStateParsingTrailers
+		} else {
+			r.bodyRemaining = size
+			r.state = requestStateParsingChunkData
 		}
+		return idx + len(CRLF), nil
 
-		// if len(r.Body) < CLInt {
-		// 	return 0, errors.New("error: body length less than header specified value")
-		// }
+	case requestStateParsingChunkEnd:
+		if len(data) < len(CRLF) {
+			return 0, nil
+		}
+		if !bytes.HasPrefix(data, []byte(CRLF)) {
+			return 0, fmt.Errorf("%w: chunk data not followed by CRLF", ErrMalformedChunk)
+		}
+		r.state = requestStateParsingChunkSize
+		return len(CRLF), nil
 
-		if len(r.Body) == CLInt {
+	case requestStateParsingTrailers:
+		n, done, err := r.parseFields(r.Trailer, data)
+		if err != nil {
+			return 0, err
+		}
+
+		if done {
 			r.state = stateDone
 		}
-		return len(data), nil
+
+		return n, nil
 
 	case stateDone:
 		return 0, errors.New("error: trying to read data in a done state")
@@ -142,55 +294,131 @@ func (r *Request) Parse(data []byte) (int, error) {
 	}
 }
 
-func RequestFromReader(reader io.Reader) (*Request, error) {
-	const buffSize = 8
-	buff := make([]byte, buffSize)
-	readToIndex := 0 //bytes till which buff is filled
+// parseFields parses field lines into h, strictly if the request is.
+// Failures are reported as ErrInvalidHeader wrapping the headers error.
+func (r *Request) parseFields(h *headers.Headers, data []byte) (int, bool, error) {
+	parse := h.Parse
+	if r.strict {
+		parse = h.ParseStrict
+	}
+	n, done, err := parse(data)
+	if err != nil {
+		return n, done, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+	return n, done, nil
+}
 
-	req := &Request{
-		state:  stateInitialized,
-		Header: headers.NewHeaders(),
+// Context returns the request's context. For requests served by a server it
+// is cancelled when the connection closes or a server shutdown runs out of
+// time.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
 	}
+	return context.Background()
+}
 
-	for req.state != stateDone {
-		// parse whatever we already have.
-		if readToIndex > 0 || req.state != stateInitialized {
-			consumed, err := req.Parse(buff[:readToIndex])
-			if err != nil {
-				return nil, err
-			}
-			if consumed > 0 {
-				copy(buff, buff[consumed:readToIndex])
-				readToIndex -= consumed
-				// attempt parsing again before reading more.
-				continue
-			}
-			if req.state == stateDone {
-				break
-			}
-		}
+// WithContext returns a shallow copy of r carrying ctx, for middleware that
+// attaches request-scoped values or deadlines.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+	r2 := new(Request)
+	*r2 = *r
+	r2.ctx = ctx
+	return r2
+}
 
-		if readToIndex == len(buff) {
-			newBuff := make([]byte, len(buff)*2)
-			copy(newBuff, buff)
-			buff = newBuff
-		}
+// PathValue returns the value of the named path parameter captured by a
+// router, or "" if there is none.
+func (r *Request) PathValue(name string) string {
+	return r.pathParams[name]
+}
 
-		n, err := reader.Read(buff[readToIndex:])
-		if err != nil {
-			if err == io.EOF {
-				// Final attempt to parse remaining buffered data on EOF
-				if readToIndex > 0 || req.state != stateInitialized {
-					if _, perr := req.Parse(buff[:readToIndex]); perr != nil {
-						return nil, perr
-					}
-				}
-				break
-			}
-			return nil, err
+// SetPathValue records a path parameter so handlers can read it back with
+// PathValue.
+func (r *Request) SetPathValue(name, value string) {
+	if r.pathParams == nil {
+		r.pathParams = map[string]string{}
+	}
+	r.pathParams[name] = value
+}
+
+// ParseContentLength parses a Content-Length value. Only decimal digits are
+// taken, no sign, whitespace or list, so that both ends of a connection agree
+// on where a body ends.
+func ParseContentLength(value string) (int64, error) {
+	if value == "" || strings.Trim(value, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, value)
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, value)
+	}
+	return n, nil
+}
+
+// ParseChunkSize reads the hex size from a chunk-size line without its CRLF.
+// Only hex digits are taken, no sign or prefix. Chunk extensions after ';'
+// are checked for shape but otherwise ignored.
+func ParseChunkSize(line string) (int, error) {
+	sizeStr, ext, _ := strings.Cut(line, ";")
+	sizeStr = strings.TrimRight(sizeStr, " \t")
+	if sizeStr == "" {
+		return 0, fmt.Errorf("%w: missing chunk size", ErrMalformedChunk)
+	}
+
+	if strings.TrimLeft(sizeStr, "0123456789abcdefABCDEF") != "" {
+		return 0, fmt.Errorf("%w: invalid chunk size %q", ErrMalformedChunk, sizeStr)
+	}
+	size, err := strconv.ParseInt(sizeStr, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid chunk size %q", ErrMalformedChunk, sizeStr)
+	}
+
+	for ext != "" {
+		var param string
+		param, ext, _ = strings.Cut(ext, ";")
+		name, _, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if name == "" {
+			return 0, fmt.Errorf("%w: invalid chunk extension", ErrMalformedChunk)
 		}
+	}
+
+	return int(size), nil
+}
+
+// ProtoAtLeast reports whether the request's HTTP version is at least
+// major.minor.
+func (r *Request) ProtoAtLeast(major, minor int) bool {
+	v := r.RequestLine.HttpVersion
+	if len(v) != 3 {
+		return false
+	}
+	reqMajor, reqMinor := int(v[0]-'0'), int(v[2]-'0')
+	return reqMajor > major || (reqMajor == major && reqMinor >= minor)
+}
 
-		readToIndex += n
+// KeepAlive reports whether the client allows the connection to be reused
+// after this request. HTTP/1.1 connections persist unless the client sends
+// "Connection: close"; HTTP/1.0 ones only persist with
+// "Connection: keep-alive".
+func (r *Request) KeepAlive() bool {
+	keepAlive := r.ProtoAtLeast(1, 1)
+	for _, token := range r.Header.Tokens("Connection") {
+		switch {
+		case strings.EqualFold(token, "close"):
+			return false
+		case strings.EqualFold(token, "keep-alive"):
+			keepAlive = true
+		}
 	}
-	return req, nil
+	return keepAlive
+}
+
+// ExpectsContinue reports whether the client sent "Expect: 100-continue",
+// meaning it waits for a 100 Continue before sending the body.
+func (r *Request) ExpectsContinue() bool {
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Expect")), "100-continue")
 }
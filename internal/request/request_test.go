@@ -1,9 +1,15 @@
 package request
 
 import (
+	"bytes"
+	"context"
 	"io"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/shubh-man007/TinyProto/internal/headers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -30,6 +36,14 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+// readBody reads what is left of r.Body.
+func readBody(t *testing.T, r *Request) string {
+	t.Helper()
+	data, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	return string(data)
+}
+
 func TestRequestLineParse(t *testing.T) {
 	// // Test: Good GET Request line
 	// r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n"))
@@ -115,7 +129,8 @@ func TestRFParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "value1,value2,value3", r.Header.Get("x-custom"))
+	assert.Equal(t, "value1", r.Header.Get("x-custom"))
+	assert.Equal(t, []string{"value1", "value2", "value3"}, r.Header.Values("x-custom"))
 
 	// Test: Case Insensitive Headers
 	reader = &chunkReader{
@@ -125,9 +140,10 @@ func TestRFParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "example.com,should-not-appear,lowercase", r.Header.Get("host"))
-	assert.Equal(t, "example.com,should-not-appear,lowercase", r.Header.Get("HOST"))
-	assert.Equal(t, "example.com,should-not-appear,lowercase", r.Header.Get("HoSt"))
+	assert.Equal(t, "example.com", r.Header.Get("host"))
+	assert.Equal(t, "example.com", r.Header.Get("HOST"))
+	assert.Equal(t, "example.com", r.Header.Get("HoSt"))
+	assert.Equal(t, []string{"example.com", "should-not-appear", "lowercase"}, r.Header.Values("host"))
 
 	// Test: Missing End of Headers
 	reader = &chunkReader{
@@ -153,7 +169,7 @@ func TestRequestParse(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, "hello world!\n", readBody(t, r))
 
 	// Test: Empty Body, 0 reported content length
 	reader = &chunkReader{
@@ -166,7 +182,7 @@ func TestRequestParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	assert.Equal(t, "", readBody(t, r))
 
 	// Test: Empty Body, no reported content length
 	reader = &chunkReader{
@@ -178,7 +194,7 @@ func TestRequestParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	assert.Equal(t, "", readBody(t, r))
 
 	// Test: No Content-Length but Body Exists
 	reader = &chunkReader{
@@ -191,7 +207,742 @@ func TestRequestParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	assert.Equal(t, "", readBody(t, r))
+}
+
+func TestReaderPipelined(t *testing.T) {
+	// Test: Leftover bytes carry over into the next request
+	reader := NewReader(&chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"helloGET /second HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Connection: close\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello", readBody(t, r))
+	assert.True(t, r.KeepAlive())
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	assert.Equal(t, "", readBody(t, r))
+	assert.False(t, r.KeepAlive())
+
+	// Test: Clean EOF between requests
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 0, reader.Buffered())
+
+	// Test: EOF in the middle of a request line
+	reader = NewReader(&chunkReader{
+		data:            "GET /partial HT",
+		numBytesPerRead: 3,
+	})
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestChunkedBodyParse(t *testing.T) {
+	// Test: Chunked body with extensions and trailers
+	reader := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"7;name=value;flag\r\n, world\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello, world", readBody(t, r))
+	assert.Equal(t, "abc123", r.Trailer.Get("X-Checksum"))
+	assert.Equal(t, "", r.Header.Get("X-Checksum"))
+
+	// Test: Chunked body followed by a pipelined request
+	rr := NewReader(&chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"A\r\n0123456789\r\n" +
+			"0\r\n\r\n" +
+			"GET /next HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 5,
+	})
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", readBody(t, r))
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+
+	// Test: Both Content-Length and Transfer-Encoding
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"+5\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Missing CRLF after chunk data
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestReaderLimits(t *testing.T) {
+	// Test: Header section over the limit
+	reader := NewReader(&chunkReader{
+		data: "GET / HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"X-Padding: " + strings.Repeat("a", 100) + "\r\n" +
+			"\r\n",
+		numBytesPerRead: 16,
+	})
+	reader.MaxHeaderBytes = 64
+	_, err := reader.ReadRequest()
+	assert.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: Header section within the limit, body not counted
+	reader = NewReader(&chunkReader{
+		data: "POST / HTTP/1.1\r\n" +
+			"Content-Length: 100\r\n" +
+			"\r\n" +
+			strings.Repeat("b", 100),
+		numBytesPerRead: 16,
+	})
+	reader.MaxHeaderBytes = 64
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Len(t, readBody(t, r), 100)
+
+	// Test: Content-Length over the body limit
+	reader = NewReader(&chunkReader{
+		data: "POST / HTTP/1.1\r\n" +
+			"Content-Length: 100\r\n" +
+			"\r\n" +
+			strings.Repeat("b", 100),
+		numBytesPerRead: 16,
+	})
+	reader.MaxBodyBytes = 50
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body over the body limit
+	reader = NewReader(&chunkReader{
+		data: "POST / HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"20\r\n" + strings.Repeat("c", 32) + "\r\n" +
+			"20\r\n" + strings.Repeat("c", 32) + "\r\n" +
+			"0\r\n\r\n",
+		numBytesPerRead: 16,
+	})
+	reader.MaxBodyBytes = 50
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Content-Length over the body limit is caught with the headers
+	reader = NewReader(&chunkReader{
+		data: "POST / HTTP/1.1\r\n" +
+			"Content-Length: 100\r\n" +
+			"\r\n",
+		numBytesPerRead: 16,
+	})
+	reader.MaxBodyBytes = 50
+	_, err = reader.ReadRequestHeader()
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestBodyStreaming(t *testing.T) {
+	// Test: Body is read from the stream after the headers
+	reader := NewReader(&chunkReader{
+		data: "POST / HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 4,
+	})
+	r, err := reader.ReadRequestHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "5", r.Header.Get("Content-Length"))
+	select {
+	case <-reader.BodyDone():
+		t.Fatal("body done before it was read")
+	default:
+	}
+	assert.Equal(t, "hello", readBody(t, r))
+	<-reader.BodyDone()
+	require.NoError(t, r.Body.Close())
+
+	// Test: Unread body is discarded before the next request
+	reader = NewReader(&chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Content-Length: 10\r\n" +
+			"\r\n" +
+			"0123456789" +
+			"POST /second HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nabc\r\n3\r\ndef\r\n0\r\nX-Sum: 1\r\n\r\n" +
+			"GET /third HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	n, err := io.ReadFull(r.Body, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "0123", string(buf[:n]))
+
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	n, err = io.ReadFull(r.Body, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "abcd", string(buf[:n]))
+	assert.Equal(t, "", r.Trailer.Get("X-Sum"))
+	require.NoError(t, r.Body.Close())
+	assert.Equal(t, "1", r.Trailer.Get("X-Sum"))
+	_, err = r.Body.Read(buf)
+	assert.Error(t, err)
+
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "/third", r.RequestLine.RequestTarget)
+	assert.Equal(t, "", readBody(t, r))
+
+	// Test: Too much unread body gives up the stream
+	reader = NewReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Content-Length: " + strconv.Itoa(maxDrainBytes+10) + "\r\n" +
+		"\r\n" +
+		strings.Repeat("x", maxDrainBytes+10)))
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.Body.Close(), ErrBodyNotDrained)
+	_, err = reader.ReadRequestHeader()
+	assert.ErrorIs(t, err, ErrBodyNotDrained)
+
+	// Test: Stream ending inside the body
+	reader = NewReader(&chunkReader{
+		data: "POST / HTTP/1.1\r\n" +
+			"Content-Length: 10\r\n" +
+			"\r\n" +
+			"short",
+		numBytesPerRead: 3,
+	})
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.ErrorIs(t, r.Body.Close(), io.ErrUnexpectedEOF)
+
+	// Test: Buffered helper keeps the body and trailers in memory
+	reader = NewReader(&chunkReader{
+		data: "POST / HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n0\r\nX-Sum: 2\r\n\r\n",
+		numBytesPerRead: 2,
+	})
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "2", r.Trailer.Get("X-Sum"))
+	assert.Equal(t, "hello", readBody(t, r))
+}
+
+func TestRequestContext(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	// Test: Requests without a context use the background context
+	assert.Equal(t, context.Background(), r.Context())
+
+	// Test: WithContext returns a copy carrying the new context
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "req-1")
+	r2 := r.WithContext(ctx)
+	assert.Equal(t, "req-1", r2.Context().Value(key{}))
+	assert.Nil(t, r.Context().Value(key{}))
+	assert.Equal(t, r.RequestLine, r2.RequestLine)
+}
+
+func TestTargetParse(t *testing.T) {
+	// Test: Origin form with path and query
+	reader := &chunkReader{
+		data:            "GET /a/b/../c/./d%20e?x=1&y=hello+world&x=2&flag&z=%2F HTTP/1.1\r\nHost: localhost\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, TargetOrigin, r.Target.Form)
+	assert.Equal(t, "/a/c/d e", r.Target.Path)
+	assert.Equal(t, "/a/b/../c/./d%20e", r.Target.RawPath)
+	assert.Equal(t, "x=1&y=hello+world&x=2&flag&z=%2F", r.Target.RawQuery)
+	assert.Equal(t, []string{"1", "2"}, r.Target.Query["x"])
+	assert.Equal(t, "hello world", r.Target.Query.Get("y"))
+	assert.Equal(t, "/", r.Target.Query.Get("z"))
+	assert.True(t, r.Target.Query.Has("flag"))
+	assert.False(t, r.Target.Query.Has("missing"))
+
+	// Test: Dot-segments never climb above the root
+	target, err := ParseTarget("GET", "/../../etc/%2e%2e/passwd")
+	require.NoError(t, err)
+	assert.Equal(t, "/passwd", target.Path)
+	target, err = ParseTarget("GET", "/a/b/..")
+	require.NoError(t, err)
+	assert.Equal(t, "/a/", target.Path)
+
+	// Test: Absolute form
+	target, err = ParseTarget("GET", "HTTP://example.com:8080?q=1")
+	require.NoError(t, err)
+	assert.Equal(t, TargetAbsolute, target.Form)
+	assert.Equal(t, "http", target.Scheme)
+	assert.Equal(t, "example.com:8080", target.Host)
+	assert.Equal(t, "/", target.Path)
+	assert.Equal(t, "1", target.Query.Get("q"))
+
+	// Test: Authority form for CONNECT only
+	target, err = ParseTarget("CONNECT", "example.com:443")
+	require.NoError(t, err)
+	assert.Equal(t, TargetAuthority, target.Form)
+	assert.Equal(t, "example.com:443", target.Host)
+	_, err = ParseTarget("CONNECT", "/path")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+	_, err = ParseTarget("GET", "example.com:443")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+
+	// Test: Asterisk form for OPTIONS only
+	target, err = ParseTarget("OPTIONS", "*")
+	require.NoError(t, err)
+	assert.Equal(t, TargetAsterisk, target.Form)
+	_, err = ParseTarget("GET", "*")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+
+	// Test: Malformed percent-encoding
+	for _, raw := range []string{"/a%2", "/a%zz", "/a?x=%", "/a?%G1=1"} {
+		_, err = ParseTarget("GET", raw)
+		assert.ErrorIs(t, err, ErrInvalidPercentEncode, raw)
+	}
+	reader = &chunkReader{
+		data:            "GET /bad%zz HTTP/1.1\r\nHost: localhost\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Fragments and control characters are rejected
+	_, err = ParseTarget("GET", "/a#frag")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+	_, err = ParseTarget("GET", "/a\x01")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+}
+
+func TestFormParse(t *testing.T) {
+	// Test: Urlencoded body values come before query values
+	reader := &chunkReader{
+		data: "POST /submit?name=query&page=2 HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Content-Type: application/x-www-form-urlencoded\r\n" +
+			"Content-Length: 23\r\n" +
+			"\r\n" +
+			"name=body&note=a+b%21&x",
+		numBytesPerRead: 5,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, []string{"body", "query"}, r.Form["name"])
+	assert.Equal(t, "a b!", r.PostForm.Get("note"))
+	assert.True(t, r.PostForm.Has("x"))
+	assert.False(t, r.PostForm.Has("page"))
+	assert.Equal(t, "2", r.FormValue("page"))
+
+	// Test: Non-form bodies leave PostForm empty
+	r, err = RequestFromReader(strings.NewReader("POST /?a=1 HTTP/1.1\r\nContent-Type: text/plain\r\nContent-Length: 3\r\n\r\nb=2"))
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Empty(t, r.PostForm)
+	assert.Equal(t, "1", r.Form.Get("a"))
+	assert.ErrorIs(t, r.ParseMultipartForm(MultipartLimits{}), ErrNotMultipart)
+}
+
+func multipartRequest(t *testing.T, contentType, body string) *Request {
+	t.Helper()
+	raw := "POST /upload?q=1 HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Type: " + contentType + "\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+		"\r\n" + body
+	r, err := RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	return r
+}
+
+func TestMultipartForm(t *testing.T) {
+	body := "preamble\r\n" +
+		"--xYz\r\n" +
+		"Content-Disposition: form-data; name=\"title\"\r\n" +
+		"\r\n" +
+		"hello\r\nworld\r\n" +
+		"--xYz\r\n" +
+		"Content-Disposition: form-data; name=\"doc\"; filename=\"a \\\"b\\\".txt\"\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		strings.Repeat("0123456789", 1000) + "\r\n" +
+		"--xYz--\r\n" +
+		"epilogue"
+
+	// Test: Values and in-memory files
+	r := multipartRequest(t, `multipart/form-data; boundary="xYz"`, body)
+	require.NoError(t, r.ParseMultipartForm(MultipartLimits{}))
+	assert.Equal(t, "hello\r\nworld", r.FormValue("title"))
+	assert.Equal(t, "hello\r\nworld", r.PostForm.Get("title"))
+	assert.Equal(t, "1", r.Form.Get("q"))
+
+	f, fh, err := r.FormFile("doc")
+	require.NoError(t, err)
+	content, err := io.ReadAll(f)
+	require.NoError(t, err)
+	f.Close()
+	assert.Equal(t, `a "b".txt`, fh.Filename)
+	assert.Equal(t, "text/plain", fh.Header.Get("Content-Type"))
+	assert.Equal(t, int64(10000), fh.Size)
+	assert.Equal(t, strings.Repeat("0123456789", 1000), string(content))
+
+	// Test: Files past MaxMemory spill to a temp file
+	r = multipartRequest(t, "multipart/form-data; boundary=xYz", body)
+	require.NoError(t, r.ParseMultipartForm(MultipartLimits{MaxMemory: 100}))
+	fh = r.MultipartForm.File["doc"][0]
+	require.NotEmpty(t, fh.tmpfile)
+	f, err = fh.Open()
+	require.NoError(t, err)
+	content, err = io.ReadAll(f)
+	require.NoError(t, err)
+	f.Close()
+	assert.Equal(t, strings.Repeat("0123456789", 1000), string(content))
+	require.NoError(t, r.MultipartForm.RemoveAll())
+	_, err = os.Stat(fh.tmpfile)
+	assert.True(t, os.IsNotExist(err))
+
+	// Test: Part count and size limits
+	r = multipartRequest(t, "multipart/form-data; boundary=xYz", body)
+	assert.ErrorIs(t, r.ParseMultipartForm(MultipartLimits{MaxParts: 1}), ErrTooManyParts)
+	r = multipartRequest(t, "multipart/form-data; boundary=xYz", body)
+	assert.ErrorIs(t, r.ParseMultipartForm(MultipartLimits{MaxBytes: 1000}), ErrMultipartTooLarge)
+	r = multipartRequest(t, "multipart/form-data; boundary=xYz", body)
+	assert.ErrorIs(t, r.ParseMultipartForm(MultipartLimits{MaxMemory: 5}), ErrMultipartTooLarge)
+
+	// Test: Missing boundary and truncated bodies
+	r = multipartRequest(t, "multipart/form-data", body)
+	assert.ErrorIs(t, r.ParseMultipartForm(MultipartLimits{}), ErrMissingBoundary)
+	r = multipartRequest(t, "multipart/form-data; boundary=xYz", body[:200])
+	assert.ErrorIs(t, r.ParseMultipartForm(MultipartLimits{}), ErrMalformedMultipart)
+	assert.Nil(t, r.MultipartForm)
+}
+
+func TestCookies(t *testing.T) {
+	// Test: Cookies across Cookie lines, first match wins
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Cookie: session=abc; theme=dark\r\n" +
+		"Cookie: session=other\r\n" +
+		"\r\n"))
+	require.NoError(t, err)
+	cookies := r.Cookies()
+	require.Len(t, cookies, 3)
+	c, err := r.Cookie("session")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", c.Value)
+	_, err = r.Cookie("missing")
+	assert.ErrorIs(t, err, ErrNoCookie)
+}
+
+func TestHTTPVersions(t *testing.T) {
+	// Test: HTTP/1.0 closes unless asked to keep alive, no Host needed
+	r, err := RequestFromReader(strings.NewReader("GET /health HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.False(t, r.ProtoAtLeast(1, 1))
+	assert.False(t, r.KeepAlive())
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	// Test: HTTP/1.1 keeps alive unless asked to close
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.ProtoAtLeast(1, 1))
+	assert.True(t, r.KeepAlive())
+
+	// Test: Chunked framing is not HTTP/1.0
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"))
+	require.Error(t, err)
+
+	// Test: Other major versions are unsupported, malformed ones invalid
+	for _, version := range []string{"HTTP/2.0", "HTTP/3.0", "HTTP/0.9"} {
+		_, err = RequestFromReader(strings.NewReader("GET / " + version + "\r\n\r\n"))
+		assert.ErrorIs(t, err, ErrVersionNotSupported, version)
+	}
+	for _, version := range []string{"HTTP/1", "HTTP/1.10", "HTTP/x.1", "HTTP/11"} {
+		_, err = RequestFromReader(strings.NewReader("GET / " + version + "\r\n\r\n"))
+		require.Error(t, err, version)
+		assert.NotErrorIs(t, err, ErrVersionNotSupported, version)
+	}
+}
+
+func TestStrictParse(t *testing.T) {
+	cases := []struct {
+		name string
+		raw  string
+		err  error
+	}{
+		{"Double space in request line", "GET  / HTTP/1.1\r\nHost: x\r\n\r\n", ErrRequestLineWhitespace},
+		{"Tab in request line", "GET\t/ HTTP/1.1\r\nHost: x\r\n\r\n", ErrRequestLineWhitespace},
+		{"Trailing space in request line", "GET / HTTP/1.1 \r\nHost: x\r\n\r\n", ErrRequestLineWhitespace},
+		{"Bare LF in request line", "GET /\nX HTTP/1.1\r\nHost: x\r\n\r\n", ErrBareLineBreak},
+		{"Digits in method", "G3T / HTTP/1.1\r\nHost: x\r\n\r\n", ErrInvalidMethod},
+		{"Symbols in method", "GET! / HTTP/1.1\r\nHost: x\r\n\r\n", ErrInvalidMethod},
+		{"Missing Host", "GET / HTTP/1.1\r\n\r\n", ErrMissingHost},
+		{"Repeated Host", "GET / HTTP/1.1\r\nHost: a\r\nHost: b\r\n\r\n", ErrDuplicateHost},
+		{"Malformed Host", "GET / HTTP/1.1\r\nHost: a/b@c\r\n\r\n", ErrInvalidHost},
+		{"Non-numeric port in Host", "GET / HTTP/1.1\r\nHost: a:8o\r\n\r\n", ErrInvalidHost},
+		{"Repeated Content-Length", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 1\r\nContent-Length: 1\r\n\r\na", ErrDuplicateContentLength},
+		{"Content-Length list", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 1, 1\r\n\r\na", ErrDuplicateContentLength},
+		{"Signed Content-Length", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: +1\r\n\r\na", ErrInvalidContentLength},
+		{"Whitespace before colon", "GET / HTTP/1.1\r\nHost\t: x\r\n\r\n", headers.ErrWhitespaceBeforeColon},
+		{"Folded header line", "GET / HTTP/1.1\r\nHost: x\r\nX-A: 1\r\n 2\r\n\r\n", headers.ErrObsFold},
+		{"Folded trailer line", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nX-A: 1\r\n 2\r\n\r\n", headers.ErrObsFold},
+	}
+
+	for _, tc := range cases {
+		// Test: Each ambiguity has its own error in strict mode
+		reader := NewReader(&chunkReader{data: tc.raw, numBytesPerRead: 3})
+		reader.Strict = true
+		_, err := reader.ReadRequest()
+		assert.ErrorIs(t, err, tc.err, tc.name)
+	}
+
+	// Test: Lenient mode still takes what it used to
+	for _, raw := range []string{
+		"GET  / HTTP/1.1\r\nHost: x\r\n\r\n",
+		"GET / HTTP/1.1\r\n\r\n",
+		"GET / HTTP/1.1\r\nHost: a\r\nHost: b\r\n\r\n",
+	} {
+		_, err := RequestFromReader(strings.NewReader(raw))
+		assert.NoError(t, err, raw)
+	}
+
+	// Test: Well-formed requests pass strict mode
+	for _, raw := range []string{
+		"GET /a?b=c HTTP/1.1\r\nHost: example.com:8080\r\n\r\n",
+		"GET / HTTP/1.1\r\nHost: [::1]:80\r\n\r\n",
+		"GET / HTTP/1.0\r\n\r\n",
+		"VERSION-CONTROL / HTTP/1.1\r\nHost: x\r\n\r\n",
+		"POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 2\r\n\r\nhi",
+	} {
+		reader := NewReader(strings.NewReader(raw))
+		reader.Strict = true
+		_, err := reader.ReadRequest()
+		assert.NoError(t, err, raw)
+	}
+}
+
+func TestParseFraming(t *testing.T) {
+	// Test: Content-Length takes decimal digits only
+	n, err := ParseContentLength("1024")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1024), n)
+	for _, v := range []string{"", "+3", "-0", " 3", "3 ", "0x3", "1,1", "99999999999999999999"} {
+		_, err := ParseContentLength(v)
+		assert.ErrorIs(t, err, ErrInvalidContentLength, v)
+	}
+
+	// Test: Chunk sizes take hex digits only
+	size, err := ParseChunkSize("1aF;name=value")
+	require.NoError(t, err)
+	assert.Equal(t, 0x1af, size)
+	for _, line := range []string{"", "+3", "-0", "0x3", " 3", "ffffffffff"} {
+		_, err := ParseChunkSize(line)
+		assert.ErrorIs(t, err, ErrMalformedChunk, line)
+	}
+
+	// Test: Signed lengths are refused outside strict mode too
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: x\r\nContent-Length: +1\r\n\r\na"))
+	assert.ErrorIs(t, err, ErrInvalidContentLength)
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n-0\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrMalformedChunk)
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		raw    string
+		err    error
+		status int
+	}{
+		{"GET /\r\n\r\n", ErrMalformedRequestLine, 400},
+		{"get / HTTP/1.1\r\n\r\n", ErrInvalidMethod, 400},
+		{"GET / HTTP/1\r\n\r\n", ErrInvalidVersion, 400},
+		{"GET / HTTP/2.0\r\n\r\n", ErrVersionNotSupported, 505},
+		{"GET a%zz HTTP/1.1\r\n\r\n", ErrInvalidTarget, 400},
+		{"GET / HTTP/1.1\r\nBad Header\r\n\r\n", ErrInvalidHeader, 400},
+		{"POST / HTTP/1.1\r\nContent-Length: 1\r\nTransfer-Encoding: chunked\r\n\r\n", ErrAmbiguousFraming, 400},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n", ErrUnsupportedTransferEncoding, 501},
+		{"POST / HTTP/1.1\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\n", ErrInvalidContentLength, 400},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n", ErrMalformedChunk, 400},
+	}
+
+	for _, tc := range cases {
+		// Test: Each failure is a sentinel carrying its status
+		_, err := RequestFromReader(strings.NewReader(tc.raw))
+		assert.ErrorIs(t, err, tc.err, tc.raw)
+		var parseErr *ParseError
+		require.ErrorAs(t, err, &parseErr, tc.raw)
+		assert.Equal(t, tc.status, parseErr.Status, tc.raw)
+	}
+
+	// Test: Header errors keep the headers package cause
+	_, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nBad Header\r\n\r\n"))
+	assert.ErrorIs(t, err, headers.ErrInvalidFieldLine)
+
+	// Test: Limits carry 431 and 413
+	reader := NewReader(strings.NewReader("GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("a", 100) + "\r\n\r\n"))
+	reader.MaxHeaderBytes = 32
+	_, err = reader.ReadRequest()
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, 431, parseErr.Status)
+	reader = NewReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 100\r\n\r\n"))
+	reader.MaxBodyBytes = 10
+	_, err = reader.ReadRequest()
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, 413, parseErr.Status)
 }
 
 // go test ./...
+
+func TestNewRequest(t *testing.T) {
+	ctx := context.Background()
+
+	// Test: Known-length bodies get a Content-Length and can be replayed
+	r, err := NewRequest(ctx, "POST", "http://example.com:8080/a%20b?q=1", strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "example.com:8080", r.Target.Host)
+	assert.Equal(t, "5", r.Header.Get("Content-Length"))
+	require.NotNil(t, r.GetBody)
+	readBody(t, r)
+	again, err := r.GetBody()
+	require.NoError(t, err)
+	data, _ := io.ReadAll(again)
+	assert.Equal(t, "hello", string(data))
+
+	// Test: The caller's reader is left unread, from where it was
+	sr := strings.NewReader("skip body")
+	sr.Seek(5, io.SeekStart)
+	r, err = NewRequest(ctx, "POST", "http://example.com/", sr)
+	require.NoError(t, err)
+	assert.Equal(t, "4", r.Header.Get("Content-Length"))
+	data, _ = io.ReadAll(sr)
+	assert.Equal(t, "body", string(data))
+	br := bytes.NewReader([]byte("data"))
+	r, err = NewRequest(ctx, "POST", "http://example.com/", br)
+	require.NoError(t, err)
+	assert.Equal(t, "data", readBody(t, r))
+	assert.Equal(t, 4, br.Len())
+
+	// Test: Other bodies are sent chunked, no body gets no framing
+	r, err = NewRequest(ctx, "PUT", "https://example.com/", io.MultiReader(strings.NewReader("x")))
+	require.NoError(t, err)
+	assert.Equal(t, "chunked", r.Header.Get("Transfer-Encoding"))
+	assert.Nil(t, r.GetBody)
+	r, err = NewRequest(ctx, "GET", "http://example.com/", nil)
+	require.NoError(t, err)
+	assert.Empty(t, r.Header.Values("Content-Length"))
+	assert.Equal(t, "", readBody(t, r))
+
+	// Test: Only absolute http and https URLs and valid methods
+	for _, url := range []string{"/relative", "ftp://example.com/", "http://", "http://a b/"} {
+		_, err := NewRequest(ctx, "GET", url, nil)
+		assert.ErrorIs(t, err, ErrInvalidURL, url)
+	}
+	_, err = NewRequest(ctx, "get", "http://example.com/", nil)
+	assert.ErrorIs(t, err, ErrInvalidMethod)
+}
+
+func TestRequestWrite(t *testing.T) {
+	ctx := context.Background()
+
+	// Test: Origin form, Host from the URL, Content-Length body
+	r, err := NewRequest(ctx, "POST", "http://example.com/items?id=7", bytes.NewBufferString("abc"))
+	require.NoError(t, err)
+	r.Header.Set("Content-Type", "text/plain")
+	var buf bytes.Buffer
+	require.NoError(t, r.Write(&buf))
+	assert.Equal(t, "POST /items?id=7 HTTP/1.1\r\nHost: example.com\r\nContent-Length: 3\r\n"+
+		"Content-Type: text/plain\r\n\r\nabc", buf.String())
+
+	// Test: Chunked body and trailers read back by the parser
+	r, err = NewRequest(ctx, "PUT", "http://example.com/up", io.MultiReader(strings.NewReader("hello "), strings.NewReader("world")))
+	require.NoError(t, err)
+	r.Header.Set("Host", "override.test")
+	r.Trailer.Set("X-Sum", "42")
+	buf.Reset()
+	require.NoError(t, r.Write(&buf))
+	parsed, err := RequestFromReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "/up", parsed.RequestLine.RequestTarget)
+	assert.Equal(t, "override.test", parsed.Header.Get("Host"))
+	assert.Equal(t, "hello world", readBody(t, parsed))
+	assert.Equal(t, "42", parsed.Trailer.Get("X-Sum"))
+
+	// Test: A served request forwarded as it came
+	parsed, err = RequestFromReader(strings.NewReader("GET /x HTTP/1.0\r\nHost: a\r\n\r\n"))
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, parsed.Write(&buf))
+	assert.Equal(t, "GET /x HTTP/1.0\r\nHost: a\r\n\r\n", buf.String())
+
+	// Test: A body shorter than its Content-Length
+	r, err = NewRequest(ctx, "POST", "http://example.com/", strings.NewReader("abc"))
+	require.NoError(t, err)
+	r.Header.Replace("Content-Length", "10")
+	assert.ErrorIs(t, r.Write(io.Discard), ErrShortBody)
+
+	// Test: No Host to send
+	parsed, err = RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, parsed.Write(io.Discard), ErrMissingHost)
+}
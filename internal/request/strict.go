@@ -0,0 +1,117 @@
+package request
+
+import (
+	"strings"
+)
+
+// Errors returned in strict mode, one per ambiguity that could let a proxy
+// and this server disagree on where a request starts or ends.
+var (
+	ErrRequestLineWhitespace  = newParseError(statusBadRequest, "error: request line parts must be separated by single spaces")
+	ErrBareLineBreak          = newParseError(statusBadRequest, "error: bare CR or LF in request line")
+	ErrInvalidMethod          = newParseError(statusBadRequest, "error: invalid request method")
+	ErrMissingHost            = newParseError(statusBadRequest, "error: missing Host header")
+	ErrDuplicateHost          = newParseError(statusBadRequest, "error: multiple Host headers")
+	ErrInvalidHost            = newParseError(statusBadRequest, "error: invalid Host header")
+	ErrDuplicateContentLength = newParseError(statusBadRequest, "error: multiple Content-Length values")
+	ErrInvalidContentLength   = newParseError(statusBadRequest, "error: invalid Content-Length value")
+)
+
+// checkStrictRequestLine checks a request line, without its CRLF, against
+// RFC 9112 section 3: method SP request-target SP HTTP-version.
+func checkStrictRequestLine(line string) error {
+	if strings.ContainsAny(line, "\r\n") {
+		return ErrBareLineBreak
+	}
+	if strings.ContainsAny(line, "\t\v\f") {
+		return ErrRequestLineWhitespace
+	}
+	parts := strings.Split(line, " ")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return ErrRequestLineWhitespace
+	}
+	if !validStrictMethod(parts[0]) {
+		return ErrInvalidMethod
+	}
+	return nil
+}
+
+// validStrictMethod accepts methods shaped like the registered ones:
+// uppercase ASCII letters, with inner hyphens as in "VERSION-CONTROL".
+func validStrictMethod(method string) bool {
+	if method == "" || method[0] == '-' || method[len(method)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(method); i++ {
+		if !('A' <= method[i] && method[i] <= 'Z') && method[i] != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkStrictHeaders checks the complete header section: exactly one valid
+// Host for HTTP/1.1, at most one for HTTP/1.0, and a single Content-Length
+// made of digits.
+func (r *Request) checkStrictHeaders() error {
+	hosts := r.Header.Values("Host")
+	switch {
+	case len(hosts) > 1:
+		return ErrDuplicateHost
+	case len(hosts) == 0:
+		if r.ProtoAtLeast(1, 1) {
+			return ErrMissingHost
+		}
+	case !validHost(hosts[0]):
+		return ErrInvalidHost
+	}
+
+	lengths := r.Header.Values("Content-Length")
+	if len(lengths) > 1 || (len(lengths) == 1 && strings.Contains(lengths[0], ",")) {
+		return ErrDuplicateContentLength
+	}
+	if len(lengths) == 1 {
+		if lengths[0] == "" || strings.Trim(lengths[0], "0123456789") != "" {
+			return ErrInvalidContentLength
+		}
+	}
+	return nil
+}
+
+// validHost reports whether host is an RFC 3986 host with an optional port.
+// An empty Host is allowed, for targets without an authority.
+func validHost(host string) bool {
+	if host == "" {
+		return true
+	}
+
+	name, port := host, ""
+	if host[0] == '[' {
+		end := strings.IndexByte(host, ']')
+		if end == -1 {
+			return false
+		}
+		name, port = host[1:end], host[end+1:]
+		if name == "" || strings.Trim(name, "0123456789abcdefABCDEF:.") != "" {
+			return false
+		}
+	} else {
+		if i := strings.LastIndexByte(host, ':'); i != -1 {
+			name, port = host[:i], host[i:]
+		}
+		if name == "" {
+			return false
+		}
+		for i := 0; i < len(name); i++ {
+			c := name[i]
+			if !isAlpha(c) && !isDigit(c) && !strings.ContainsRune("-._~%!$&'()*+,;=", rune(c)) {
+				return false
+			}
+		}
+	}
+
+	if port == "" {
+		return true
+	}
+	return port[0] == ':' && strings.Trim(port[1:], "0123456789") == ""
+}
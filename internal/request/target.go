@@ -0,0 +1,239 @@
+package request
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Request-target forms, RFC 9112 section 3.2.
+const (
+	// TargetOrigin is an absolute path with an optional query, "/where?q=now".
+	TargetOrigin = iota
+	// TargetAbsolute is a full URI, as sent to proxies.
+	TargetAbsolute
+	// TargetAuthority is the "host:port" of a CONNECT request.
+	TargetAuthority
+	// TargetAsterisk is the "*" of a server-wide OPTIONS request.
+	TargetAsterisk
+)
+
+var (
+	ErrInvalidTarget        = newParseError(statusBadRequest, "error: invalid request target")
+	ErrInvalidPercentEncode = newParseError(statusBadRequest, "error: invalid percent-encoding in request target")
+)
+
+// Target is a parsed request-target.
+type Target struct {
+	Form int
+	// Scheme and Host are set for absolute-form targets; Host alone for
+	// authority-form ones.
+	Scheme string
+	Host   string
+	// Path is percent-decoded with dot-segments removed. RawPath is the path
+	// as sent.
+	Path     string
+	RawPath  string
+	RawQuery string
+	Query    Query
+}
+
+// Query holds decoded query parameters, keeping every value of a repeated key
+// in order.
+type Query map[string][]string
+
+// Get returns the first value of key, or "" if there is none.
+func (q Query) Get(key string) string {
+	if values := q[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Has reports whether key is present, even with an empty value.
+func (q Query) Has(key string) bool {
+	_, ok := q[key]
+	return ok
+}
+
+// ParseTarget parses the request-target of a request with the given method.
+// CONNECT only takes the authority form and "*" is only valid for OPTIONS.
+func ParseTarget(method, raw string) (Target, error) {
+	for i := 0; i < len(raw); i++ {
+		if raw[i] <= ' ' || raw[i] == 0x7f || raw[i] == '#' {
+			return Target{}, ErrInvalidTarget
+		}
+	}
+
+	switch {
+	case method == "CONNECT":
+		host, port, err := net.SplitHostPort(raw)
+		if err != nil || host == "" || strings.ContainsAny(raw, "/?@") {
+			return Target{}, ErrInvalidTarget
+		}
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return Target{}, ErrInvalidTarget
+		}
+		return Target{Form: TargetAuthority, Host: raw}, nil
+
+	case raw == "*":
+		if method != "OPTIONS" {
+			return Target{}, ErrInvalidTarget
+		}
+		return Target{Form: TargetAsterisk, Path: "*", RawPath: "*", Query: Query{}}, nil
+
+	case strings.HasPrefix(raw, "/"):
+		return parseOriginForm(TargetOrigin, raw)
+	}
+
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok || !validScheme(scheme) {
+		return Target{}, ErrInvalidTarget
+	}
+	host := rest
+	pathAndQuery := "/"
+	if idx := strings.IndexAny(rest, "/?"); idx != -1 {
+		host = rest[:idx]
+		pathAndQuery = rest[idx:]
+		if pathAndQuery[0] == '?' {
+			pathAndQuery = "/" + pathAndQuery
+		}
+	}
+	if host == "" || strings.Contains(host, "@") {
+		return Target{}, ErrInvalidTarget
+	}
+
+	t, err := parseOriginForm(TargetAbsolute, pathAndQuery)
+	if err != nil {
+		return Target{}, err
+	}
+	t.Scheme = strings.ToLower(scheme)
+	t.Host = host
+	return t, nil
+}
+
+func validScheme(scheme string) bool {
+	if scheme == "" || !isAlpha(scheme[0]) {
+		return false
+	}
+	for i := 1; i < len(scheme); i++ {
+		c := scheme[i]
+		if !isAlpha(c) && !('0' <= c && c <= '9') && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func parseOriginForm(form int, raw string) (Target, error) {
+	rawPath, rawQuery, _ := strings.Cut(raw, "?")
+
+	path, err := unescape(rawPath, false)
+	if err != nil {
+		return Target{}, err
+	}
+	query, err := ParseQuery(rawQuery)
+	if err != nil {
+		return Target{}, err
+	}
+
+	return Target{
+		Form:     form,
+		Path:     removeDotSegments(path),
+		RawPath:  rawPath,
+		RawQuery: rawQuery,
+		Query:    query,
+	}, nil
+}
+
+// ParseQuery decodes an application/x-www-form-urlencoded string such as a
+// query, where '+' stands for a space.
+func ParseQuery(raw string) (Query, error) {
+	query := Query{}
+	for raw != "" {
+		var pair string
+		pair, raw, _ = strings.Cut(raw, "&")
+		if pair == "" {
+			continue
+		}
+
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := unescape(rawKey, true)
+		if err != nil {
+			return nil, err
+		}
+		value, err := unescape(rawValue, true)
+		if err != nil {
+			return nil, err
+		}
+		query[key] = append(query[key], value)
+	}
+	return query, nil
+}
+
+// unescape decodes %XX sequences, and '+' as a space when plusSpace is set.
+func unescape(s string, plusSpace bool) (string, error) {
+	if !strings.ContainsAny(s, "%+") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return "", ErrInvalidPercentEncode
+			}
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		case s[i] == '+' && plusSpace:
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// removeDotSegments resolves "." and ".." segments of an absolute path as in
+// RFC 3986 section 5.2.4, never climbing above the root.
+func removeDotSegments(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	out := make([]string, 0, len(segments))
+	for i, seg := range segments {
+		switch seg {
+		case ".":
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, seg)
+			continue
+		}
+		// A trailing dot-segment leaves the path ending in a slash.
+		if i == len(segments)-1 {
+			out = append(out, "")
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
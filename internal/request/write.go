@@ -0,0 +1,184 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/shubh-man007/TinyProto/internal/headers"
+)
+
+// writeChunkSize is the largest chunk Write sends for a chunked body.
+const writeChunkSize = 32 << 10
+
+var (
+	ErrInvalidURL = errors.New("error: request URL must be an absolute http or https URL")
+	ErrShortBody  = errors.New("error: request body shorter than its Content-Length")
+)
+
+// NewRequest builds a request for a client to send to url, an absolute http
+// or https URL. A body whose length is known up front, a *bytes.Buffer,
+// *bytes.Reader or *strings.Reader, gets a Content-Length and a GetBody to
+// replay it; any other body is sent chunked. body may be nil.
+func NewRequest(ctx context.Context, method, url string, body io.Reader) (*Request, error) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	if !validStrictMethod(method) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidMethod, method)
+	}
+	target, err := ParseTarget(method, url)
+	if err != nil || target.Form != TargetAbsolute || (target.Scheme != "http" && target.Scheme != "https") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidURL, url)
+	}
+
+	r := &Request{
+		RequestLine: RequestLine{Method: method, RequestTarget: url, HttpVersion: "1.1"},
+		Header:      headers.NewHeaders(),
+		Trailer:     headers.NewHeaders(),
+		Target:      target,
+		state:       stateDone,
+		ctx:         ctx,
+	}
+
+	var data []byte
+	switch b := body.(type) {
+	case nil:
+		r.Body = io.NopCloser(strings.NewReader(""))
+		return r, nil
+	case *bytes.Buffer:
+		data = b.Bytes()
+	// Readers are copied before reading, leaving the caller's where it was.
+	case *bytes.Reader:
+		snapshot := *b
+		data = make([]byte, snapshot.Len())
+		snapshot.Read(data)
+	case *strings.Reader:
+		snapshot := *b
+		data = make([]byte, snapshot.Len())
+		snapshot.Read(data)
+	default:
+		r.Body = io.NopCloser(body)
+		r.Header.Set("Transfer-Encoding", "chunked")
+		return r, nil
+	}
+
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	r.Body, _ = r.GetBody()
+	if len(data) > 0 || methodAllowsBody(method) {
+		r.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	}
+	return r, nil
+}
+
+// methodAllowsBody reports whether an empty body of a request with method is
+// worth a "Content-Length: 0", as servers expect one on these.
+func methodAllowsBody(method string) bool {
+	return method == "POST" || method == "PUT" || method == "PATCH"
+}
+
+// Write sends r on w as a client would. A request built from an absolute URL
+// goes out in origin form, with its Host taken from the URL unless a Host
+// header is set. The body is framed by the Content-Length or
+// Transfer-Encoding header, and a chunked body is followed by Trailer as it
+// stands once Body has reached its end. Write does not close Body.
+func (r *Request) Write(w io.Writer) error {
+	if err := r.Header.Validate(); err != nil {
+		return err
+	}
+	host := ""
+	if len(r.Header.Values("Host")) == 0 {
+		if r.Target.Host == "" {
+			return ErrMissingHost
+		}
+		host = r.Target.Host
+	}
+
+	target := r.RequestLine.RequestTarget
+	if r.Target.Form == TargetAbsolute {
+		target = r.Target.RawPath
+		if r.Target.RawQuery != "" {
+			target += "?" + r.Target.RawQuery
+		}
+	}
+	version := r.RequestLine.HttpVersion
+	if version == "" {
+		version = "1.1"
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s %s HTTP/%s%s", r.RequestLine.Method, target, version, CRLF)
+	if host != "" {
+		fmt.Fprintf(bw, "Host: %s%s", host, CRLF)
+	}
+	for key, value := range r.Header.Iter() {
+		fmt.Fprintf(bw, "%s: %s%s", key, value, CRLF)
+	}
+	bw.WriteString(CRLF)
+
+	codings := r.Header.Tokens("Transfer-Encoding")
+	switch {
+	case len(codings) > 0 && strings.EqualFold(codings[len(codings)-1], "chunked"):
+		if err := r.writeChunked(bw); err != nil {
+			return err
+		}
+
+	case r.Header.Get("Content-Length") != "":
+		n, err := ParseContentLength(r.Header.Get("Content-Length"))
+		if err != nil {
+			return err
+		}
+		copied, err := io.CopyN(bw, r.bodyReader(), n)
+		if err == io.EOF || copied < n {
+			return ErrShortBody
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeChunked sends the body in chunks, flushing each so that a streamed
+// body goes out as it is produced, then the last chunk and trailers.
+func (r *Request) writeChunked(bw *bufio.Writer) error {
+	buf := make([]byte, writeChunkSize)
+	body := r.bodyReader()
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(bw, "%x%s", n, CRLF)
+			bw.Write(buf[:n])
+			bw.WriteString(CRLF)
+			if ferr := bw.Flush(); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	bw.WriteString("0" + CRLF)
+	if r.Trailer != nil {
+		if err := r.Trailer.Validate(); err != nil {
+			return err
+		}
+		for key, value := range r.Trailer.Iter() {
+			fmt.Fprintf(bw, "%s: %s%s", key, value, CRLF)
+		}
+	}
+	bw.WriteString(CRLF)
+	return nil
+}
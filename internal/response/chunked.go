@@ -0,0 +1,110 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shubh-man007/TinyProto/internal/headers"
+)
+
+// WriteChunk sends p as a single chunk of a chunked body. The headers must
+// have declared "Transfer-Encoding: chunked". Empty writes are skipped since
+// a zero-length chunk would end the body.
+func (w *Writer) WriteChunk(p []byte) (int, error) {
+	if w.Status != WriterStatusBody && w.Status != WriterStatusDone {
+		return 0, errors.New("state mismatch: must write headers before body")
+	}
+	if !w.chunked {
+		return 0, errors.New("state mismatch: response is not chunked, use WriteBody")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.noBody {
+		w.Status = WriterStatusDone
+		return len(p), nil
+	}
+	if w.unframed {
+		n, err := w.writer.Write(p)
+		w.bodyWritten += n
+		if err != nil {
+			return n, err
+		}
+		w.Status = WriterStatusDone
+		return n, nil
+	}
+
+	_, err := w.writer.Write([]byte(fmt.Sprintf("%x%s", len(p), CRLF)))
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.writer.Write(p)
+	w.bodyWritten += n
+	if err != nil {
+		return n, err
+	}
+	_, err = w.writer.Write([]byte(CRLF))
+	if err != nil {
+		return n, err
+	}
+
+	w.Status = WriterStatusDone
+	return n, nil
+}
+
+// WriteChunkedDone sends the last chunk followed by trailers, which may be
+// nil. Every trailer must have been announced in the Trailer header. An
+// HTTP/1.0 client gets neither, its body ends when the connection closes.
+func (w *Writer) WriteChunkedDone(trailers *headers.Headers) error {
+	if w.Status != WriterStatusBody && w.Status != WriterStatusDone {
+		return errors.New("state mismatch: must write headers before trailers")
+	}
+	if !w.chunked {
+		return errors.New("state mismatch: trailers need a chunked response")
+	}
+
+	var fields string
+	if trailers != nil {
+		if err := trailers.Validate(); err != nil {
+			return err
+		}
+		for key, value := range trailers.Iter() {
+			if !w.trailerNames[strings.ToLower(key)] {
+				return fmt.Errorf("trailer %q was not announced in the Trailer header", key)
+			}
+			fields += fmt.Sprintf("%s: %s%s", w.fieldName(key), value, CRLF)
+		}
+	}
+
+	if !w.unframed && !w.noBody {
+		_, err := w.writer.Write([]byte("0" + CRLF + fields + CRLF))
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Status = WriterStatusClosed
+	return nil
+}
+
+type chunkedWriter struct {
+	w        *Writer
+	trailers *headers.Headers
+}
+
+func (cw *chunkedWriter) Write(p []byte) (int, error) {
+	return cw.w.WriteChunk(p)
+}
+
+func (cw *chunkedWriter) Close() error {
+	return cw.w.WriteChunkedDone(cw.trailers)
+}
+
+// ChunkedWriter returns a writer that frames each Write as a chunk and ends
+// the body on Close, sending trailers. Since trailers is only read on Close,
+// it can be filled in while the body is being written.
+func (w *Writer) ChunkedWriter(trailers *headers.Headers) io.WriteCloser {
+	return &chunkedWriter{w: w, trailers: trailers}
+}
@@ -0,0 +1,15 @@
+package response
+
+import (
+	"github.com/shubh-man007/TinyProto/internal/cookie"
+	"github.com/shubh-man007/TinyProto/internal/headers"
+)
+
+// SetCookie adds c to h as its own Set-Cookie line. An invalid cookie is
+// reported and not added.
+func SetCookie(h *headers.Headers, c *cookie.Cookie) error {
+	if err := c.Valid(); err != nil {
+		return err
+	}
+	return h.Add("Set-Cookie", c.String())
+}
@@ -0,0 +1,343 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/shubh-man007/TinyProto/internal/headers"
+	"github.com/shubh-man007/TinyProto/internal/request"
+)
+
+const (
+	responseStateStatusLine = iota
+	responseStateHeaders
+	responseStateDone
+)
+
+// maxResponseHeaderBytes bounds the status line and headers of a response, and
+// separately its trailers.
+const maxResponseHeaderBytes = 1 << 20
+
+var (
+	ErrMalformedResponse      = errors.New("error: malformed response")
+	ErrResponseHeaderTooLarge = errors.New("error: response header too large")
+	ErrMalformedChunk         = errors.New("error: malformed chunk in response body")
+)
+
+// Response is a response read off a connection by ReadResponse, the
+// client-side counterpart of request.Request.
+type Response struct {
+	// Proto is the version of the status line, e.g. "HTTP/1.1".
+	Proto      string
+	StatusCode StatusCode
+	Reason     string
+	Header     *headers.Headers
+	// Body streams the body following its framing. It is never nil; a
+	// response without a body reads as empty.
+	Body io.ReadCloser
+	// Trailer holds the fields sent after the last chunk of a chunked body.
+	// It is filled once Body has been read to its end.
+	Trailer *headers.Headers
+	// ContentLength is the length of the body, or -1 when it is chunked or
+	// runs to the end of the stream.
+	ContentLength int64
+	// Close reports whether the connection cannot carry another exchange
+	// after this response.
+	Close bool
+
+	state int
+}
+
+// ReadResponse reads the status line and headers of the next response on r,
+// for a request with the given method, and sets Body up to stream its body.
+// 1xx interim responses are returned like final ones, without a body; read
+// again for what follows. Body must be read to its end before the next
+// response on r.
+func ReadResponse(r *bufio.Reader, method string) (*Response, error) {
+	res := &Response{Header: headers.NewHeaders(), Trailer: headers.NewHeaders()}
+
+	head, err := readHead(r, res.parse, func() bool { return res.state == responseStateDone })
+	if err != nil {
+		if err == io.EOF && head == 0 {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	if err := res.setBody(r, method); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// readHead feeds r to parse line by line until done reports true, and
+// returns the number of bytes read. Lines must end in CRLF.
+func readHead(r *bufio.Reader, parse func([]byte) (int, error), done func() bool) (int, error) {
+	var buf []byte
+	read := 0
+	for !done() {
+		line, err := r.ReadSlice('\n')
+		read += len(line)
+		buf = append(buf, line...)
+		if read > maxResponseHeaderBytes {
+			return read, ErrResponseHeaderTooLarge
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			if err == io.EOF && read > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return read, err
+		}
+		if !bytes.HasSuffix(line, []byte(CRLF)) {
+			return read, fmt.Errorf("%w: bare LF", ErrMalformedResponse)
+		}
+
+		for !done() {
+			n, err := parse(buf)
+			if err != nil {
+				return read, err
+			}
+			if n == 0 {
+				break
+			}
+			buf = buf[n:]
+		}
+	}
+	return read, nil
+}
+
+func (res *Response) parse(data []byte) (int, error) {
+	switch res.state {
+	case responseStateStatusLine:
+		idx := bytes.Index(data, []byte(CRLF))
+		if idx == -1 {
+			return 0, nil
+		}
+		if err := res.parseStatusLine(string(data[:idx])); err != nil {
+			return 0, err
+		}
+		res.state = responseStateHeaders
+		return idx + len(CRLF), nil
+
+	case responseStateHeaders:
+		n, done, err := res.Header.Parse(data)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrMalformedResponse, err)
+		}
+		if done {
+			res.state = responseStateDone
+		}
+		return n, nil
+
+	case responseStateDone:
+		return 0, errors.New("error: trying to read data in a done state")
+
+	default:
+		return 0, errors.New("error: unknown state")
+	}
+}
+
+// parseStatusLine parses "HTTP/1.1 200 OK". The reason phrase may be empty or
+// missing altogether.
+func (res *Response) parseStatusLine(line string) error {
+	proto, rest, _ := strings.Cut(line, " ")
+	codeText, reason, _ := strings.Cut(rest, " ")
+
+	version, ok := strings.CutPrefix(proto, "HTTP/")
+	if !ok || len(version) != 3 || version[0] != '1' || version[1] != '.' || version[2] < '0' || version[2] > '9' {
+		return fmt.Errorf("%w: status line %q", ErrMalformedResponse, line)
+	}
+	code, err := strconv.Atoi(codeText)
+	if err != nil || len(codeText) != 3 || code < 100 {
+		return fmt.Errorf("%w: status line %q", ErrMalformedResponse, line)
+	}
+
+	res.Proto = proto
+	res.StatusCode = StatusCode(code)
+	res.Reason = reason
+	return nil
+}
+
+// setBody works out the body framing of RFC 9112 section 6.3 and sets Body,
+// ContentLength and Close accordingly.
+func (res *Response) setBody(r *bufio.Reader, method string) error {
+	res.Close = res.Proto == "HTTP/1.0"
+	for _, token := range res.Header.Tokens("Connection") {
+		switch {
+		case strings.EqualFold(token, "close"):
+			res.Close = true
+		case strings.EqualFold(token, "keep-alive") && res.Proto == "HTTP/1.0":
+			res.Close = false
+		}
+	}
+
+	code := res.StatusCode
+	if method == "HEAD" || (code >= 100 && code <= 199) || code == StatusNoContent || code == StatusNotModified {
+		res.Body = io.NopCloser(strings.NewReader(""))
+		if code == StatusSwitchingProtocols {
+			res.Close = true
+		}
+		return nil
+	}
+
+	res.ContentLength = -1
+	codings := res.Header.Tokens("Transfer-Encoding")
+	if len(codings) > 0 {
+		if strings.EqualFold(codings[len(codings)-1], "chunked") && res.Proto != "HTTP/1.0" {
+			res.Body = io.NopCloser(&chunkedReader{r: r, res: res})
+			return nil
+		}
+		// Any other coding runs to the end of the stream.
+		res.Body = io.NopCloser(r)
+		res.Close = true
+		return nil
+	}
+
+	lengths := res.Header.Values("Content-Length")
+	if len(lengths) == 0 {
+		res.Body = io.NopCloser(r)
+		res.Close = true
+		return nil
+	}
+	for _, v := range lengths[1:] {
+		if v != lengths[0] {
+			return fmt.Errorf("%w: conflicting Content-Length values %q and %q", ErrMalformedResponse, lengths[0], v)
+		}
+	}
+	n, err := request.ParseContentLength(lengths[0])
+	if err != nil {
+		return fmt.Errorf("%w: Content-Length %q", ErrMalformedResponse, lengths[0])
+	}
+
+	res.ContentLength = n
+	res.Body = io.NopCloser(&fixedReader{r: r, remaining: n})
+	return nil
+}
+
+// fixedReader reads a body of known length.
+type fixedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (fr *fixedReader) Read(p []byte) (int, error) {
+	if fr.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > fr.remaining {
+		p = p[:fr.remaining]
+	}
+	n, err := fr.r.Read(p)
+	fr.remaining -= int64(n)
+	if err == io.EOF && fr.remaining > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	if fr.remaining == 0 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// chunkedReader decodes a chunked body, reading its trailers into
+// res.Trailer once the last chunk is reached.
+type chunkedReader struct {
+	r         *bufio.Reader
+	res       *Response
+	remaining int64
+	err       error
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	if cr.err != nil {
+		return 0, cr.err
+	}
+
+	if cr.remaining == 0 {
+		size, err := cr.readChunkSize()
+		if err == nil && size == 0 {
+			err = cr.readTrailers()
+			if err == nil {
+				err = io.EOF
+			}
+		}
+		if err != nil {
+			cr.err = err
+			return 0, err
+		}
+		cr.remaining = size
+	}
+
+	if int64(len(p)) > cr.remaining {
+		p = p[:cr.remaining]
+	}
+	n, err := cr.r.Read(p)
+	cr.remaining -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && cr.remaining == 0 {
+		err = cr.readChunkEnd()
+	}
+	if err != nil {
+		cr.err = err
+	}
+	return n, err
+}
+
+// readChunkSize reads a chunk-size line, checked as a request's would be.
+func (cr *chunkedReader) readChunkSize() (int64, error) {
+	line, err := cr.r.ReadSlice('\n')
+	if err != nil {
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, fmt.Errorf("%w: chunk size line too long", ErrMalformedChunk)
+	}
+	if !bytes.HasSuffix(line, []byte(CRLF)) {
+		return 0, fmt.Errorf("%w: chunk size line %q", ErrMalformedChunk, line)
+	}
+	size, err := request.ParseChunkSize(string(line[:len(line)-len(CRLF)]))
+	if err != nil {
+		return 0, fmt.Errorf("%w: chunk size line %q", ErrMalformedChunk, line)
+	}
+	return int64(size), nil
+}
+
+// readChunkEnd reads the CRLF ending chunk data.
+func (cr *chunkedReader) readChunkEnd() error {
+	var end [2]byte
+	if _, err := io.ReadFull(cr.r, end[:]); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if string(end[:]) != CRLF {
+		return fmt.Errorf("%w: chunk data not followed by CRLF", ErrMalformedChunk)
+	}
+	return nil
+}
+
+func (cr *chunkedReader) readTrailers() error {
+	done := false
+	_, err := readHead(cr.r, func(data []byte) (int, error) {
+		n, ok, err := cr.res.Trailer.Parse(data)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrMalformedChunk, err)
+		}
+		done = ok
+		return n, nil
+	}, func() bool { return done })
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -14,43 +14,135 @@ const CRLF = "\r\n"
 
 type StatusCode int
 
-const (
-	StatusOK                  StatusCode = 200
-	StatusBadRequest          StatusCode = 400
-	StatusInternalServerError StatusCode = 500
-	StatusUnrecog             StatusCode = -1
-)
-
 const (
 	WriterStatusInit = iota
 	WriterStatusHeader
 	WriterStatusBody
 	WriterStatusDone
+	// WriterStatusClosed follows the last chunk and trailers of a chunked
+	// body, nothing more can be written.
+	WriterStatusClosed
 )
 
 type Writer struct {
 	Status int
 	writer io.Writer
+
+	keepAlive     bool
+	contentLength int
+	bodyWritten   int
+	chunked       bool
+	trailerNames  map[string]bool
+	statusCode    StatusCode
+	defaults      *headers.Headers
+	canonical     bool
+	http10        bool
+	head          bool
+	// noBody is set for responses that never carry a body: to HEAD, 1xx,
+	// 204 and 304. What the handler writes as a body is discarded.
+	noBody bool
+	// unframed is set when a chunked body goes to an HTTP/1.0 client, which
+	// gets the raw data delimited by closing the connection instead.
+	unframed bool
 }
 
 func NewWriter(w io.Writer) *Writer {
-	return &Writer{writer: w}
+	return &Writer{writer: w, contentLength: -1}
+}
+
+// StatusCode returns the status code written in the status line, or 0 if the
+// status line has not been written yet.
+func (w *Writer) StatusCode() StatusCode {
+	return w.statusCode
+}
+
+// BytesWritten returns the number of body bytes written so far, not counting
+// chunk framing.
+func (w *Writer) BytesWritten() int {
+	return w.bodyWritten
+}
+
+// SetCanonicalNames makes the writer send header and trailer names in
+// canonical form, e.g. "Content-Type", whatever casing they were set with.
+func (w *Writer) SetCanonicalNames(canonical bool) {
+	w.canonical = canonical
+}
+
+// fieldName returns name as it should go on the wire.
+func (w *Writer) fieldName(name string) string {
+	if w.canonical {
+		return headers.CanonicalName(name)
+	}
+	return name
+}
+
+// SetDefaultHeader adds a field that WriteHeaders sends unless the handler's
+// headers already carry one with the same name.
+func (w *Writer) SetDefaultHeader(name, value string) error {
+	if w.defaults == nil {
+		w.defaults = headers.NewHeaders()
+	}
+	return w.defaults.Replace(name, value)
+}
+
+// SetRequestVersion makes the writer answer in a version compatible with the
+// request's, "1.0" or "1.1", so an HTTP/1.0 client gets an HTTP/1.0 status
+// line, no interim responses and no chunked framing. It must be called before
+// WriteStatusLine.
+func (w *Writer) SetRequestVersion(version string) {
+	w.http10 = version == "1.0"
+}
+
+// SetRequestMethod tells the writer the method of the request it answers, so
+// the response to a HEAD request goes out without a body. It must be called
+// before WriteHeaders.
+func (w *Writer) SetRequestMethod(method string) {
+	w.head = method == "HEAD"
+}
+
+// statusLine builds the status line for code in the response's version.
+func (w *Writer) statusLine(code StatusCode) (string, error) {
+	if w.http10 {
+		return versionedStatusLine("HTTP/1.0", code)
+	}
+	return statusLine(code)
+}
+
+// SetKeepAlive tells the writer whether the connection may be reused once the
+// response is done. It must be called before WriteHeaders; a writer that is
+// not kept alive sends "Connection: close".
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// KeepAlive reports whether the connection can carry another request after
+// this response. It is false if the client or handler asked to close, if the
+// response had no Content-Length or chunked framing, or if the body written
+// does not match the declared Content-Length. Responses without a body, such
+// as to HEAD, are complete once their headers are out.
+func (w *Writer) KeepAlive() bool {
+	if !w.keepAlive || w.Status == WriterStatusInit || w.Status == WriterStatusHeader {
+		return false
+	}
+	if w.noBody {
+		return true
+	}
+	if w.contentLength >= 0 && w.bodyWritten != w.contentLength {
+		return false
+	}
+	if w.chunked && w.Status != WriterStatusClosed {
+		return false
+	}
+	return true
 }
 
 func WriteStatusLine(w io.Writer, statusCode StatusCode) (StatusCode, error) {
-	var rp string
-	switch statusCode {
-	case StatusOK:
-		rp = "HTTP/1.1 200 OK"
-	case StatusBadRequest:
-		rp = "HTTP/1.1 400 Bad Request"
-	case StatusInternalServerError:
-		rp = "HTTP/1.1 500 Internal Server Error"
-	default:
-		return StatusUnrecog, errors.New("unsupported status code")
-	}
-
-	_, err := w.Write([]byte(rp + CRLF))
+	rp, err := statusLine(statusCode)
+	if err != nil {
+		return StatusUnrecog, err
+	}
+
+	_, err = w.Write([]byte(rp + CRLF))
 	if err != nil {
 		return statusCode, errors.New("could not write to connection")
 	}
@@ -60,12 +152,19 @@ func WriteStatusLine(w io.Writer, statusCode StatusCode) (StatusCode, error) {
 func GetDefaultHeaders(contentLen int) *headers.Headers {
 	h := headers.NewHeaders()
 	h.Set("Content-Length", strconv.Itoa(contentLen))
-	h.Set("Connection", "close")
+	h.Set("Connection", "keep-alive")
 	h.Set("Content-Type", "text/plain")
 	return h
 }
 
+// WriteResHeaders writes h and the blank line ending the header section. A
+// field that fails headers.ValidateField is reported as a *headers.FieldError
+// before anything is written.
 func WriteResHeaders(w io.Writer, h *headers.Headers) error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+
 	for key, value := range h.Iter() {
 		fieldLine := fmt.Sprintf("%s: %s%s", key, value, CRLF)
 		_, err := w.Write([]byte(fieldLine))
@@ -85,35 +184,91 @@ func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 		return errors.New("state mismatch, status line parsed or skipped")
 	}
 
-	var rp string
-	switch statusCode {
-	case StatusOK:
-		rp = "HTTP/1.1 200 OK"
-	case StatusBadRequest:
-		rp = "HTTP/1.1 400 Bad Request"
-	case StatusInternalServerError:
-		rp = "HTTP/1.1 500 Internal Server Error"
-	default:
-		return errors.New("unsupported status code")
+	rp, err := w.statusLine(statusCode)
+	if err != nil {
+		return err
 	}
 
-	_, err := w.writer.Write([]byte(rp + CRLF))
+	_, err = w.writer.Write([]byte(rp + CRLF))
 	if err != nil {
 		return err
 	}
 
+	w.statusCode = statusCode
 	w.Status = WriterStatusHeader
 
 	return nil
 }
 
+// WriteInterim sends a 1xx interim response, such as 100 Continue or 103
+// Early Hints with its Link fields, ahead of the final response. h may be
+// nil. It can be called any number of times before WriteStatusLine. HTTP/1.0
+// clients do not understand interim responses, for them it does nothing.
+func (w *Writer) WriteInterim(statusCode StatusCode, h *headers.Headers) error {
+	if w.Status != WriterStatusInit {
+		return errors.New("state mismatch, interim response after status line")
+	}
+	// 101 hands the connection over to another protocol, it is a final
+	// answer as far as this writer is concerned.
+	if statusCode < 100 || statusCode > 199 || statusCode == StatusSwitchingProtocols {
+		return fmt.Errorf("%d is not an interim status code", statusCode)
+	}
+	if w.http10 {
+		return nil
+	}
+
+	rp, err := statusLine(statusCode)
+	if err != nil {
+		return err
+	}
+	res := rp + CRLF
+	if h != nil {
+		if err := h.Validate(); err != nil {
+			return err
+		}
+		for key, value := range h.Iter() {
+			res += fmt.Sprintf("%s: %s%s", w.fieldName(key), value, CRLF)
+		}
+	}
+
+	_, err = w.writer.Write([]byte(res + CRLF))
+	return err
+}
+
 func (w *Writer) WriteHeaders(headers *headers.Headers) error {
 	if w.Status != WriterStatusHeader {
 		return errors.New("state mismatch, headers parsed or skipped")
 	}
 
+	// Reject fields that could inject lines before anything goes out, the
+	// writer stays in the header state so a clean set can still be sent.
+	if err := headers.Validate(); err != nil {
+		return err
+	}
+
+	// Defaults and framing go into a copy, the caller's fields stay as they
+	// were and can be used for another response.
+	headers = headers.Clone()
+	if w.defaults != nil {
+		for key, value := range w.defaults.Iter() {
+			if len(headers.Values(key)) == 0 {
+				headers.Add(key, value)
+			}
+		}
+	}
+
+	w.noBody = w.head || bodiless(w.statusCode)
+	w.checkFraming(headers)
+	switch {
+	case !w.keepAlive:
+		headers.Replace("Connection", "close")
+	case w.http10 && len(headers.Values("Connection")) == 0:
+		// HTTP/1.0 connections close unless told otherwise.
+		headers.Add("Connection", "keep-alive")
+	}
+
 	for key, value := range headers.Iter() {
-		fieldLine := fmt.Sprintf("%s: %s%s", key, value, CRLF)
+		fieldLine := fmt.Sprintf("%s: %s%s", w.fieldName(key), value, CRLF)
 		_, err := w.writer.Write([]byte(fieldLine))
 		if err != nil {
 			return err
@@ -134,8 +289,16 @@ func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.Status != WriterStatusBody && w.Status != WriterStatusDone {
 		return 0, errors.New("state mismatch: must write headers before body")
 	}
+	if w.chunked {
+		return 0, errors.New("state mismatch: chunked response, use WriteChunk")
+	}
+	if w.noBody {
+		w.Status = WriterStatusDone
+		return len(p), nil
+	}
 
 	n, err := w.writer.Write(p)
+	w.bodyWritten += n
 	if err != nil {
 		return 0, err
 	}
@@ -144,47 +307,67 @@ func (w *Writer) WriteBody(p []byte) (int, error) {
 	return n, nil
 }
 
-func (w *Writer) WriteTrailers(headers *headers.Headers) error {
-	if w.Status != WriterStatusDone {
-		return errors.New("state mismatch: must write headers before body")
+// checkFraming records the declared body length and drops keep-alive when the
+// response cannot be delimited on a persistent connection.
+func (w *Writer) checkFraming(h *headers.Headers) {
+	for _, token := range h.Tokens("Connection") {
+		if strings.EqualFold(token, "close") {
+			w.keepAlive = false
+		}
 	}
 
-	trailerStr := headers.Get("Trailer")
-	trailers := strings.Split(trailerStr, ",")
-
-	for _, key := range trailers {
-		value := headers.Get(key)
-		fieldLine := fmt.Sprintf("%s: %s%s", key, value, CRLF)
-		_, err := w.writer.Write([]byte(fieldLine))
-		if err != nil {
-			return err
+	codings := h.Tokens("Transfer-Encoding")
+	if len(codings) > 0 && strings.EqualFold(codings[len(codings)-1], "chunked") {
+		w.chunked = true
+		w.trailerNames = map[string]bool{}
+		for _, name := range h.Tokens("Trailer") {
+			w.trailerNames[strings.ToLower(name)] = true
+		}
+		if w.http10 {
+			// The body still goes through WriteChunk, without framing, and
+			// ends when the connection closes.
+			h.Delete("Transfer-Encoding")
+			h.Delete("Trailer")
+			w.unframed = true
+			w.keepAlive = w.keepAlive && w.noBody
 		}
+		return
 	}
 
-	_, err := w.writer.Write([]byte(CRLF))
-	if err != nil {
-		return err
+	cl, err := strconv.Atoi(h.Get("Content-Length"))
+	if err != nil || cl < 0 {
+		w.keepAlive = w.keepAlive && w.noBody
+		return
 	}
+	w.contentLength = cl
+}
 
-	return nil
+// bodiless reports whether responses with code never carry a body.
+func bodiless(code StatusCode) bool {
+	return (code >= 100 && code < 200) || code == StatusNoContent || code == StatusNotModified
+}
+
+// WriteTrailers ends a chunked body, sending as trailers the fields of h
+// named in its Trailer header.
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
+	trailers := headers.NewHeaders()
+	for _, key := range h.Tokens("Trailer") {
+		for _, value := range h.Values(key) {
+			trailers.Add(key, value)
+		}
+	}
+	return w.WriteChunkedDone(trailers)
 }
 
 func (w *Writer) LogResponse(statusCode StatusCode, h *headers.Headers, body string) string {
-	if w.Status != WriterStatusDone {
+	if w.Status != WriterStatusDone && w.Status != WriterStatusClosed {
 		return errors.New("state mismatch, response not formed yet").Error()
 	}
 
 	var res string
-	var rp string
-	switch statusCode {
-	case StatusOK:
-		rp = "HTTP/1.1 200 OK"
-	case StatusBadRequest:
-		rp = "HTTP/1.1 400 Bad Request"
-	case StatusInternalServerError:
-		rp = "HTTP/1.1 500 Internal Server Error"
-	default:
-		return errors.New("unsupported status code").Error()
+	rp, err := w.statusLine(statusCode)
+	if err != nil {
+		return err.Error()
 	}
 
 	rp += CRLF
@@ -0,0 +1,364 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/shubh-man007/TinyProto/internal/cookie"
+	"github.com/shubh-man007/TinyProto/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusLine(t *testing.T) {
+	// Test: Registered codes use their reason phrase
+	var buf bytes.Buffer
+	code, err := WriteStatusLine(&buf, StatusNotFound)
+	require.NoError(t, err)
+	assert.Equal(t, StatusNotFound, code)
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n", buf.String())
+	assert.Equal(t, "Gateway Timeout", StatusText(StatusGatewayTimeout))
+	assert.Equal(t, "", StatusText(299))
+
+	// Test: Unregistered codes in range get a generic phrase
+	buf.Reset()
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(299))
+	assert.Equal(t, "HTTP/1.1 299 Success\r\n", buf.String())
+
+	// Test: Out of range codes are rejected
+	code, err = WriteStatusLine(&buf, 600)
+	require.Error(t, err)
+	assert.Equal(t, StatusUnrecog, code)
+	w = NewWriter(&buf)
+	require.Error(t, w.WriteStatusLine(99))
+}
+
+func TestWriteHeaders(t *testing.T) {
+	// Test: Fields go out in order with their casing, duplicates kept apart
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "0")
+	h.Set("Set-Cookie", "a=1")
+	h.Set("x-custom", "yes")
+	h.Set("Set-Cookie", "b=2")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"Set-Cookie: a=1\r\n"+
+		"x-custom: yes\r\n"+
+		"Set-Cookie: b=2\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Canonical names on request
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.SetCanonicalNames(true)
+	h = headers.NewHeaders()
+	h.Set("content-length", "0")
+	h.Set("x-custom", "yes")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nX-Custom: yes\r\n\r\n", buf.String())
+
+	// Test: Defaults and Connection don't end up in the caller's fields
+	h = headers.NewHeaders()
+	h.Set("Content-Length", "0")
+	h.Set("Connection", "keep-alive")
+	for range 2 {
+		buf.Reset()
+		w = NewWriter(&buf)
+		w.SetDefaultHeader("Server", "TinyProto")
+		w.SetKeepAlive(false)
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(h))
+		assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\nServer: TinyProto\r\n\r\n", buf.String())
+	}
+	assert.Equal(t, 2, h.Len())
+	assert.Equal(t, "keep-alive", h.Get("Connection"))
+}
+
+func TestChunkedWriter(t *testing.T) {
+	// Test: Chunks, last chunk and announced trailers
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	buf.Reset()
+
+	trailers := headers.NewHeaders()
+	cw := w.ChunkedWriter(trailers)
+	_, err := cw.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = cw.Write([]byte(", world!!"))
+	require.NoError(t, err)
+	_, err = cw.Write(nil)
+	require.NoError(t, err)
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, cw.Close())
+	assert.Equal(t, "5\r\nhello\r\n9\r\n, world!!\r\n0\r\nX-Checksum: abc\r\n\r\n", buf.String())
+	assert.Equal(t, WriterStatusClosed, w.Status)
+
+	// Test: No writes after the body is closed
+	_, err = w.WriteChunk([]byte("late"))
+	require.Error(t, err)
+
+	// Test: Trailer not announced in the Trailer header
+	w = NewWriter(&buf)
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	trailers = headers.NewHeaders()
+	trailers.Set("X-Sneaky", "1")
+	require.Error(t, w.WriteChunkedDone(trailers))
+
+	// Test: Chunked and fixed-length writes do not mix
+	_, err = w.WriteBody([]byte("raw"))
+	require.Error(t, err)
+
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(3)))
+	_, err = w.WriteChunk([]byte("abc"))
+	require.Error(t, err)
+	require.Error(t, w.WriteChunkedDone(nil))
+	_, err = w.WriteBody([]byte("abc"))
+	require.NoError(t, err)
+}
+
+func TestWriteInterim(t *testing.T) {
+	// Test: Interim responses precede the final one
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	hints := headers.NewHeaders()
+	hints.Set("Link", "</style.css>; rel=preload; as=style")
+	require.NoError(t, w.WriteInterim(StatusContinue, nil))
+	require.NoError(t, w.WriteInterim(StatusEarlyHints, hints))
+	assert.Equal(t, WriterStatusInit, w.Status)
+	require.NoError(t, w.WriteStatusLine(StatusNoContent))
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\n"+
+		"Link: </style.css>; rel=preload; as=style\r\n"+
+		"\r\n"+
+		"HTTP/1.1 204 No Content\r\n", buf.String())
+
+	// Test: Only 1xx codes other than 101, before the status line
+	w = NewWriter(&buf)
+	require.Error(t, w.WriteInterim(StatusOK, nil))
+	require.Error(t, w.WriteInterim(StatusSwitchingProtocols, nil))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.Error(t, w.WriteInterim(StatusContinue, nil))
+}
+
+func TestSetCookie(t *testing.T) {
+	// Test: Each cookie gets its own Set-Cookie line
+	h := headers.NewHeaders()
+	require.NoError(t, SetCookie(h, &cookie.Cookie{Name: "a", Value: "1", HttpOnly: true}))
+	require.NoError(t, SetCookie(h, &cookie.Cookie{Name: "b", Value: "2", Path: "/"}))
+	assert.Equal(t, []string{"a=1; HttpOnly", "b=2; Path=/"}, h.Values("Set-Cookie"))
+
+	// Test: Invalid cookies are not added
+	assert.ErrorIs(t, SetCookie(h, &cookie.Cookie{Name: "c", Value: "x;y"}), cookie.ErrInvalidValue)
+	assert.Len(t, h.Values("Set-Cookie"), 2)
+}
+
+func TestHTTP10Writer(t *testing.T) {
+	// Test: Status line echoes 1.0, keep-alive is spelled out
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetRequestVersion("1.0")
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteInterim(StatusContinue, nil))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "2")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteBody([]byte("ok"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nContent-Length: 2\r\nConnection: keep-alive\r\n\r\nok", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Chunked responses go out unframed and close the connection
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetRequestVersion("1.0")
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Sum")
+	require.NoError(t, w.WriteHeaders(h))
+	cw := w.ChunkedWriter(nil)
+	_, err = cw.Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = cw.Write([]byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, cw.Close())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: close\r\n\r\nhello world", buf.String())
+	assert.False(t, w.KeepAlive())
+}
+
+func TestBodilessWriter(t *testing.T) {
+	// Test: HEAD keeps its Content-Length, drops the body and stays alive
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetRequestMethod("HEAD")
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Contains(t, buf.String(), "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: A chunked HEAD response sends no chunks
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetRequestMethod("HEAD")
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	cw := w.ChunkedWriter(nil)
+	_, err = cw.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, cw.Close())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: 304 and 204 are complete without a body
+	for _, code := range []StatusCode{StatusNotModified, StatusNoContent} {
+		w = NewWriter(&bytes.Buffer{})
+		w.SetKeepAlive(true)
+		require.NoError(t, w.WriteStatusLine(code))
+		h = headers.NewHeaders()
+		h.Set("Content-Length", "120")
+		require.NoError(t, w.WriteHeaders(h))
+		assert.True(t, w.KeepAlive(), code)
+	}
+}
+
+func readResponse(t *testing.T, raw, method string) (*Response, string, error) {
+	t.Helper()
+	res, err := ReadResponse(bufio.NewReader(strings.NewReader(raw)), method)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := io.ReadAll(res.Body)
+	return res, string(body), err
+}
+
+func TestReadResponse(t *testing.T) {
+	// Test: Content-Length body
+	res, body, err := readResponse(t, "HTTP/1.1 404 Not Found\r\nContent-Length: 5\r\nX-A: 1\r\n\r\nhello", "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1", res.Proto)
+	assert.Equal(t, StatusNotFound, res.StatusCode)
+	assert.Equal(t, "Not Found", res.Reason)
+	assert.Equal(t, "1", res.Header.Get("X-A"))
+	assert.Equal(t, int64(5), res.ContentLength)
+	assert.False(t, res.Close)
+	assert.Equal(t, "hello", body)
+
+	// Test: Chunked body with extensions and trailers
+	res, body, err = readResponse(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Sum\r\n\r\n"+
+		"6;ext=1\r\nhello \r\n5\r\nworld\r\n0\r\nX-Sum: 42\r\n\r\n", "GET")
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), res.ContentLength)
+	assert.Equal(t, "hello world", body)
+	assert.Equal(t, "42", res.Trailer.Get("X-Sum"))
+
+	// Test: Body running to the end of the stream
+	res, body, err = readResponse(t, "HTTP/1.1 200 OK\r\n\r\nuntil close", "GET")
+	require.NoError(t, err)
+	assert.True(t, res.Close)
+	assert.Equal(t, "until close", body)
+
+	// Test: Responses without a body whatever their headers say
+	for _, c := range []struct{ raw, method string }{
+		{"HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n", "HEAD"},
+		{"HTTP/1.1 204 No Content\r\n\r\n", "GET"},
+		{"HTTP/1.1 304 Not Modified\r\nContent-Length: 10\r\n\r\n", "GET"},
+		{"HTTP/1.1 103 Early Hints\r\nLink: </a.css>\r\n\r\n", "GET"},
+	} {
+		res, body, err := readResponse(t, c.raw, c.method)
+		require.NoError(t, err, c.raw)
+		assert.Equal(t, int64(0), res.ContentLength, c.raw)
+		assert.Empty(t, body, c.raw)
+	}
+
+	// Test: Connection reuse follows the version and Connection header
+	for raw, closed := range map[string]bool{
+		"HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n":      true,
+		"HTTP/1.0 200 OK\r\nContent-Length: 0\r\n\r\n":                           true,
+		"HTTP/1.0 200 OK\r\nContent-Length: 0\r\nConnection: keep-alive\r\n\r\n": false,
+	} {
+		res, _, err := readResponse(t, raw, "GET")
+		require.NoError(t, err, raw)
+		assert.Equal(t, closed, res.Close, raw)
+	}
+
+	// Test: Consecutive responses on one stream, with a missing reason phrase
+	r := bufio.NewReader(strings.NewReader("HTTP/1.1 200\r\nContent-Length: 2\r\n\r\nok" +
+		"HTTP/1.1 201 Created\r\nContent-Length: 3\r\n\r\nnew"))
+	res, err = ReadResponse(r, "GET")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "ok", string(data))
+	assert.Equal(t, "", res.Reason)
+	res, err = ReadResponse(r, "GET")
+	require.NoError(t, err)
+	data, _ = io.ReadAll(res.Body)
+	assert.Equal(t, StatusCreated, res.StatusCode)
+	assert.Equal(t, "new", string(data))
+	_, err = ReadResponse(r, "GET")
+	assert.Equal(t, io.EOF, err)
+
+	// Test: Truncated messages
+	_, _, err = readResponse(t, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort", "GET")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, _, err = readResponse(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nab", "GET")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, _, err = readResponse(t, "HTTP/1.1 200 OK\r\nContent-", "GET")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Malformed messages
+	for _, raw := range []string{
+		"HTTP/2.0 200 OK\r\n\r\n",
+		"HTTP/1.1 99 Odd\r\n\r\n",
+		"HTTP/1.1 OK\r\n\r\n",
+		"HTTP/1.1 200 OK\nContent-Length: 0\n\n",
+		"HTTP/1.1 200 OK\r\nBad Name: x\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: -1\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: +3\r\n\r\nabc",
+		"HTTP/1.1 200 OK\r\nContent-Length: 0x3\r\n\r\nabc",
+	} {
+		_, _, err := readResponse(t, raw, "GET")
+		assert.ErrorIs(t, err, ErrMalformedResponse, raw)
+	}
+	for _, raw := range []string{
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabcX\r\n",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n+3\r\nabc\r\n0\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n-0\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n0x3\r\nabc\r\n0\r\n\r\n",
+	} {
+		_, _, err := readResponse(t, raw, "GET")
+		assert.ErrorIs(t, err, ErrMalformedChunk, raw)
+	}
+}
@@ -0,0 +1,310 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/shubh-man007/TinyProto/internal/server"
+)
+
+const (
+	segmentStatic = iota
+	segmentParam
+	segmentWildcard
+)
+
+type segment struct {
+	kind  int
+	value string // literal text, or parameter name
+}
+
+type route struct {
+	method   string
+	host     string
+	segments []segment
+	handler  server.Handler
+}
+
+// Router dispatches requests to handlers by method, host and path. Its Serve
+// method is a server.Handler.
+//
+// Patterns are an optional host followed by a path, e.g. "/users/{id}" or
+// "api.example.com/users/{id}". A "{name}" segment matches exactly one path
+// segment; a final "{name...}" segment matches the rest of the path. Paths
+// are split as sent, so "%2F" does not separate segments. Captured values are
+// percent-decoded and available through request.Request.PathValue.
+type Router struct {
+	routes []*route
+
+	// NotFound handles requests that match no route. When nil a plain 404
+	// is sent.
+	NotFound server.Handler
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers h for requests with the given method whose host and path
+// match pattern. An empty method matches every method.
+func (rt *Router) Handle(method, pattern string, h server.Handler) error {
+	host, path := pattern, ""
+	if idx := strings.Index(pattern, "/"); idx != -1 {
+		host, path = pattern[:idx], pattern[idx:]
+	}
+	if path == "" {
+		return fmt.Errorf("invalid pattern %q: missing path", pattern)
+	}
+
+	segments, err := parsePattern(path)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %s", pattern, err.Error())
+	}
+
+	rt.routes = append(rt.routes, &route{
+		method:   method,
+		host:     strings.ToLower(host),
+		segments: segments,
+		handler:  h,
+	})
+	return nil
+}
+
+func (rt *Router) Get(pattern string, h server.Handler) error {
+	return rt.Handle("GET", pattern, h)
+}
+
+func (rt *Router) Post(pattern string, h server.Handler) error {
+	return rt.Handle("POST", pattern, h)
+}
+
+func (rt *Router) Put(pattern string, h server.Handler) error {
+	return rt.Handle("PUT", pattern, h)
+}
+
+func (rt *Router) Delete(pattern string, h server.Handler) error {
+	return rt.Handle("DELETE", pattern, h)
+}
+
+func parsePattern(path string) ([]segment, error) {
+	parts := splitPath(path)
+	segments := make([]segment, 0, len(parts))
+
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			if strings.ContainsAny(part, "{}") {
+				return nil, fmt.Errorf("malformed segment %q", part)
+			}
+			segments = append(segments, segment{kind: segmentStatic, value: part})
+			continue
+		}
+
+		name := part[1 : len(part)-1]
+		kind := segmentParam
+		if strings.HasSuffix(name, "...") {
+			if i != len(parts)-1 {
+				return nil, errors.New("wildcard must be the last segment")
+			}
+			name = strings.TrimSuffix(name, "...")
+			kind = segmentWildcard
+		}
+		if name == "" || strings.ContainsAny(name, "{}") {
+			return nil, fmt.Errorf("malformed segment %q", part)
+		}
+		segments = append(segments, segment{kind: kind, value: name})
+	}
+
+	return segments, nil
+}
+
+// splitPath splits a path into its segments, keeping a trailing empty
+// segment so that "/a/" and "/a" stay distinct.
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// match reports whether the decoded path segments fit the route, returning the
+// captured parameters.
+func (r *route) match(parts []string) (map[string]string, bool) {
+	params := map[string]string{}
+	for i, seg := range r.segments {
+		if seg.kind == segmentWildcard {
+			params[seg.value] = strings.Join(parts[i:], "/")
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch seg.kind {
+		case segmentStatic:
+			if parts[i] != seg.value {
+				return nil, false
+			}
+		case segmentParam:
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[seg.value] = parts[i]
+		}
+	}
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+// moreSpecific reports whether a should win over b when both match. Routes
+// bound to a host win over hostless ones, then segments are compared in order
+// with static beating parameters beating wildcards.
+func moreSpecific(a, b *route) bool {
+	if (a.host != "") != (b.host != "") {
+		return a.host != ""
+	}
+	for i := 0; i < len(a.segments) && i < len(b.segments); i++ {
+		if a.segments[i].kind != b.segments[i].kind {
+			return a.segments[i].kind < b.segments[i].kind
+		}
+	}
+	return len(a.segments) > len(b.segments)
+}
+
+// requestHost returns the host a request is for, taking an absolute-form
+// target over the Host header.
+func requestHost(req *request.Request) string {
+	host := req.Target.Host
+	if host == "" {
+		host = req.Header.Get("Host")
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// requestSegments splits the path of a request as it was sent and decodes
+// each segment on its own, so that an escaped "/" stays inside its segment.
+// Dot-segments are resolved as for Target.Path. Requests that were not parsed
+// fall back to the raw target.
+func requestSegments(req *request.Request) []string {
+	path := req.Target.RawPath
+	if path == "" {
+		path, _, _ = strings.Cut(req.RequestLine.RequestTarget, "?")
+	}
+
+	parts := splitPath(path)
+	segments := make([]string, 0, len(parts))
+	for i, part := range parts {
+		seg, err := url.PathUnescape(part)
+		if err != nil {
+			seg = part
+		}
+		switch seg {
+		case ".":
+		case "..":
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+		default:
+			segments = append(segments, seg)
+			continue
+		}
+		// A trailing dot-segment leaves the path ending in a slash.
+		if i == len(parts)-1 {
+			segments = append(segments, "")
+		}
+	}
+	return segments
+}
+
+// Serve dispatches req to the most specific matching route. A HEAD request
+// with no route of its own goes to the GET route, the writer leaving out the
+// body. It answers 404 when no route matches the path and 405, with an Allow
+// header, when routes match the path but not the method.
+func (rt *Router) Serve(w *response.Writer, req *request.Request) {
+	host := requestHost(req)
+	parts := requestSegments(req)
+	method := req.RequestLine.Method
+
+	var best, get *route
+	var bestParams, getParams map[string]string
+	pathMatched := false
+	allowed := map[string]bool{}
+
+	for _, r := range rt.routes {
+		if r.host != "" && r.host != host {
+			continue
+		}
+		params, ok := r.match(parts)
+		if !ok {
+			continue
+		}
+		pathMatched = true
+		if r.method != "" && r.method != method {
+			allowed[r.method] = true
+			if method == "HEAD" && r.method == "GET" && (get == nil || moreSpecific(r, get)) {
+				get, getParams = r, params
+			}
+			continue
+		}
+		if best == nil || moreSpecific(r, best) {
+			best, bestParams = r, params
+		}
+	}
+	if best == nil {
+		best, bestParams = get, getParams
+	}
+
+	if best == nil {
+		if pathMatched {
+			if allowed["GET"] {
+				allowed["HEAD"] = true
+			}
+			methods := make([]string, 0, len(allowed))
+			for m := range allowed {
+				methods = append(methods, m)
+			}
+			sort.Strings(methods)
+			writeError(w, response.StatusMethodNotAllowed, strings.Join(methods, ", "))
+			return
+		}
+		if rt.NotFound != nil {
+			rt.NotFound(w, req)
+			return
+		}
+		writeError(w, response.StatusNotFound, "")
+		return
+	}
+
+	for name, value := range bestParams {
+		req.SetPathValue(name, value)
+	}
+	best.handler(w, req)
+}
+
+func writeError(w *response.Writer, code response.StatusCode, allow string) {
+	body := []byte(strconv.Itoa(int(code)) + " " + response.StatusText(code) + "\n")
+	h := response.GetDefaultHeaders(len(body))
+	if allow != "" {
+		h.Set("Allow", allow)
+	}
+
+	if err := w.WriteStatusLine(code); err != nil {
+		log.Printf("Error writing status line: %v", err)
+		return
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		log.Printf("Error writing headers: %v", err)
+		return
+	}
+	if _, err := w.WriteBody(body); err != nil {
+		log.Printf("Error writing body: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package router
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// named returns a handler that writes name followed by the given path values.
+func named(name string, params ...string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		body := name
+		for _, p := range params {
+			body += " " + p + "=" + req.PathValue(p)
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody([]byte(body))
+	}
+}
+
+func serve(t *testing.T, rt *Router, raw string) string {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	rt.Serve(response.NewWriter(&buf), req)
+	return buf.String()
+}
+
+func TestRouter(t *testing.T) {
+	rt := New()
+	require.NoError(t, rt.Get("/users", named("list")))
+	require.NoError(t, rt.Get("/users/{id}", named("get", "id")))
+	require.NoError(t, rt.Delete("/users/{id}", named("delete", "id")))
+	require.NoError(t, rt.Get("/users/me", named("me")))
+	require.NoError(t, rt.Handle("", "/static/{path...}", named("static", "path")))
+	require.NoError(t, rt.Get("api.example.com/users/{id}", named("api", "id")))
+
+	// Test: Static route
+	res := serve(t, rt, "GET /users HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nlist"))
+
+	// Test: Path parameter, query string ignored
+	res = serve(t, rt, "GET /users/42?full=1 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nget id=42"))
+
+	// Test: Static segment beats parameter
+	res = serve(t, rt, "GET /users/me HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nme"))
+
+	// Test: Method-specific route
+	res = serve(t, rt, "DELETE /users/7 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\ndelete id=7"))
+
+	// Test: Wildcard suffix matches any method
+	res = serve(t, rt, "POST /static/css/site.css HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nstatic path=css/site.css"))
+
+	// Test: Host-based route wins for its host
+	res = serve(t, rt, "GET /users/9 HTTP/1.1\r\nHost: API.example.com:8080\r\n\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\napi id=9"))
+
+	// Test: Decoded and normalized path, absolute-form host
+	res = serve(t, rt, "GET http://api.example.com/static/../users/%39 HTTP/1.1\r\nHost: other\r\n\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\napi id=9"))
+
+	// Test: Unknown path
+	res = serve(t, rt, "GET /nope HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Known path, wrong method
+	res = serve(t, rt, "PUT /users/7 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, res, "Allow: DELETE, GET, HEAD\r\n")
+
+	// Test: Escaped slash stays inside its segment and is decoded after
+	res = serve(t, rt, "GET /users/a%2Fb HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nget id=a/b"))
+
+	// Test: HEAD falls back to the GET route without the body
+	req, err := request.RequestFromReader(strings.NewReader("HEAD /users/7 HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	w.SetRequestMethod("HEAD")
+	rt.Serve(w, req)
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, buf.String(), "Content-Length: 8\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+
+	// Test: A route for HEAD itself wins over GET
+	require.NoError(t, rt.Handle("HEAD", "/users/{id}", named("head", "id")))
+	res = serve(t, rt, "HEAD /users/7 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nhead id=7"))
+
+	// Test: Custom not found handler
+	rt.NotFound = named("custom")
+	res = serve(t, rt, "GET /nope HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\ncustom"))
+
+	// Test: Invalid patterns
+	require.Error(t, rt.Get("/files/{rest...}/more", named("bad")))
+	require.Error(t, rt.Get("/users/{}", named("bad")))
+	require.Error(t, rt.Get("example.com", named("bad")))
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor systemd passes to an activated
+// service.
+const listenFDsStart = 3
+
+var ErrInvalidAddress = errors.New("error: invalid listen address")
+
+// Listen opens a listener for addr, one of:
+//
+//	tcp://127.0.0.1:8080   TCP, also tcp4:// and tcp6://; port 0 picks a free one
+//	unix:///run/app.sock   Unix domain socket
+//	fd://3                 an inherited, already listening file descriptor
+//
+// An address without a scheme is a TCP host:port. A Unix socket file left
+// behind by a process that died is removed first.
+func Listen(addr string) (net.Listener, error) {
+	network, address, ok := strings.Cut(addr, "://")
+	if !ok {
+		network, address = "tcp", addr
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return net.Listen(network, address)
+	case "unix":
+		if address == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidAddress, addr)
+		}
+		removeStaleSocket(address)
+		return net.Listen(network, address)
+	case "fd":
+		fd, err := strconv.Atoi(address)
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidAddress, addr)
+		}
+		return fileListener(fd, addr)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrInvalidAddress, addr)
+}
+
+// SystemdListeners returns the sockets passed by systemd socket activation,
+// in the order of the socket unit, or none when the process was not started
+// that way. The activation variables are cleared so that child processes do
+// not take the sockets for theirs.
+func SystemdListeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "fd://" + strconv.Itoa(listenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		l, err := fileListener(listenFDsStart+i, name)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// fileListener turns the listening socket fd into a net.Listener. The
+// listener holds its own copy of fd, which is closed.
+func fileListener(fd int, name string) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), name)
+	if f == nil {
+		return nil, fmt.Errorf("%w: bad file descriptor %d", ErrInvalidAddress, fd)
+	}
+	defer f.Close()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", name, err)
+	}
+	return l, nil
+}
+
+// removeStaleSocket removes the socket file at path if nothing accepts on it
+// anymore. Anything else at path is left for net.Listen to fail on.
+func removeStaleSocket(path string) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return
+	}
+	os.Remove(path)
+}
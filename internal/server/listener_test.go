@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTarget sends a request for target over a new connection to addr and
+// returns the echoed body.
+func getTarget(t *testing.T, addr net.Addr, target string) string {
+	t.Helper()
+	conn, err := net.Dial(addr.Network(), addr.String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET " + target + " HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	status, _, body := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+	return body
+}
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+
+	// Test: TCP with and without a scheme, port 0 picks a free port
+	for _, addr := range []string{"tcp://127.0.0.1:0", "tcp4://127.0.0.1:0", "127.0.0.1:0"} {
+		l, err := Listen(addr)
+		require.NoError(t, err, addr)
+		assert.NotEqual(t, 0, l.Addr().(*net.TCPAddr).Port)
+		l.Close()
+	}
+
+	// Test: Unix socket
+	sock := filepath.Join(dir, "app.sock")
+	l, err := Listen("unix://" + sock)
+	require.NoError(t, err)
+	assert.Equal(t, "unix", l.Addr().Network())
+	assert.Equal(t, sock, l.Addr().String())
+
+	// Test: A socket still accepting is not taken over
+	_, err = Listen("unix://" + sock)
+	assert.Error(t, err)
+
+	// Test: A socket file left behind by a dead process is replaced
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	_, err = os.Stat(sock)
+	require.NoError(t, err)
+	l, err = Listen("unix://" + sock)
+	require.NoError(t, err)
+	l.Close()
+
+	// Test: Inherited file descriptor
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f, err := tcp.(*net.TCPListener).File()
+	require.NoError(t, err)
+	// Listen takes ownership of the descriptor, so it gets its own.
+	fd, err := syscall.Dup(int(f.Fd()))
+	require.NoError(t, err)
+	f.Close()
+	l, err = Listen("fd://" + strconv.Itoa(fd))
+	require.NoError(t, err)
+	assert.Equal(t, tcp.Addr().String(), l.Addr().String())
+	l.Close()
+	tcp.Close()
+
+	// Test: Malformed addresses
+	for _, addr := range []string{"udp://127.0.0.1:0", "unix://", "fd://abc", "fd://-1"} {
+		_, err := Listen(addr)
+		assert.ErrorIs(t, err, ErrInvalidAddress, addr)
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	// Test: Variables meant for another process are ignored and cleared
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	listeners, err := SystemdListeners()
+	require.NoError(t, err)
+	assert.Empty(t, listeners)
+	_, set := os.LookupEnv("LISTEN_FDS")
+	assert.False(t, set)
+
+	// Test: No activation at all
+	listeners, err = SystemdListeners()
+	require.NoError(t, err)
+	assert.Empty(t, listeners)
+}
+
+func TestServeListeners(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "app.sock")
+
+	// Test: One server on a TCP port and a Unix socket
+	s, err := ServeAddr("tcp://127.0.0.1:0", echoTarget)
+	require.NoError(t, err)
+	require.NoError(t, s.ServeAddr("unix://"+sock, echoTarget))
+
+	addrs := s.Addrs()
+	require.Len(t, addrs, 2)
+	assert.Equal(t, addrs[0], s.Addr())
+	assert.Equal(t, "tcp", addrs[0].Network())
+	assert.Equal(t, sock, addrs[1].String())
+
+	assert.Equal(t, "/tcp", getTarget(t, addrs[0], "/tcp"))
+	assert.Equal(t, "/unix", getTarget(t, addrs[1], "/unix"))
+
+	// Test: A custom net.Listener with its own handler leaves the others'
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, s.ServeListener(l, func(w *response.Writer, req *request.Request) {
+		req.RequestLine.RequestTarget = "custom " + req.RequestLine.RequestTarget
+		echoTarget(w, req)
+	}))
+	assert.Equal(t, "custom /x", getTarget(t, l.Addr(), "/x"))
+	assert.Equal(t, "/x", getTarget(t, addrs[0], "/x"))
+	assert.Equal(t, "/x", getTarget(t, addrs[1], "/x"))
+
+	// Test: Shutdown closes every listener and refuses new ones
+	_, err = s.Shutdown(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, s.Addr())
+	for _, addr := range addrs {
+		_, err := net.Dial(addr.Network(), addr.String())
+		assert.Error(t, err)
+	}
+	_, err = os.Stat(sock)
+	assert.True(t, os.IsNotExist(err))
+
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.ServeListener(l, echoTarget), ErrServerClosed)
+
+	// Test: Serve reports the port picked for port 0
+	s2, err := Serve(0, echoTarget)
+	require.NoError(t, err)
+	defer s2.Close()
+	assert.NotEqual(t, 0, s2.Port)
+	assert.Equal(t, s2.Port, s2.Addr().(*net.TCPAddr).Port)
+
+	// Test: A bad address is reported
+	_, err = ServeAddr("udp://127.0.0.1:0", echoTarget)
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
@@ -1,13 +1,18 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"runtime/debug"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/shubh-man007/TinyProto/internal/request"
 	"github.com/shubh-man007/TinyProto/internal/response"
@@ -15,11 +20,72 @@ import (
 
 // const resp = "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 13\r\n\r\nHello World!\n"
 
+const (
+	DefaultIdleTimeout        = 60 * time.Second
+	DefaultMaxRequestsPerConn = 100
+	DefaultMaxHeaderBytes     = 1 << 20
+)
+
+const (
+	connStateIdle = iota
+	connStateActive
+)
+
+var (
+	ErrServerClosed = errors.New("error: server is shut down")
+	// ErrClientGone is the cause of a request context cancelled because the
+	// client closed its connection, see context.Cause.
+	ErrClientGone = errors.New("error: client closed the connection")
+)
+
+// shutdownPollInterval is how often Shutdown checks for connections that
+// have finished or gone idle.
+const shutdownPollInterval = 10 * time.Millisecond
+
 type Server struct {
-	Port     int
-	handler  Handler
-	listener net.Listener
-	closed   atomic.Bool
+	Port int
+
+	// ReadHeaderTimeout bounds reading the request line and headers, counted
+	// from the first byte of the request. Zero means no limit.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading the whole request, body included, counted
+	// from the first byte of the request. Zero means no limit.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing the response, counted from the end of the
+	// request headers. Zero means no limit.
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a connection may sit waiting for its next
+	// request before it is closed. Zero means DefaultIdleTimeout.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes caps the size of the request line and headers. Zero
+	// means DefaultMaxHeaderBytes, a negative value means no limit.
+	MaxHeaderBytes int
+	// MaxBodyBytes caps the size of a request body, larger ones get a 413.
+	// Zero or a negative value means no limit.
+	MaxBodyBytes int
+	// MaxRequestsPerConn is the number of requests served on one connection
+	// before it is closed. Zero means DefaultMaxRequestsPerConn, a negative
+	// value means no limit.
+	MaxRequestsPerConn int
+	// StrictParsing rejects requests that RFC 9112 leaves ambiguous, see
+	// request.Reader.Strict. Turn it on behind a proxy.
+	StrictParsing bool
+	// TLSConfig is used by ServeTLS, which copies it. Set ClientAuth and
+	// ClientCAs on it to ask clients for certificates, or GetCertificate to a
+	// CertStore's to pick certificates by server name.
+	TLSConfig *tls.Config
+	// PanicHook, when set, is called with the recovered value and stack trace
+	// after a handler panics, e.g. to forward it to error tracking.
+	PanicHook func(req *request.Request, rec any, stack []byte)
+
+	listeners    []net.Listener
+	closed       atomic.Bool
+	shuttingDown atomic.Bool
+
+	mu         sync.Mutex
+	conns      map[net.Conn]int
+	baseCtx    context.Context
+	cancelBase context.CancelCauseFunc
 }
 
 type HandlerError struct {
@@ -47,6 +113,7 @@ func (herr *HandlerError) WriteErrorResponse(w io.Writer) error {
 	}
 
 	h := response.GetDefaultHeaders(len(message))
+	h.Replace("Connection", "close")
 	err = response.WriteResHeaders(w, h)
 	if err != nil {
 		return errors.New("could not write error headers to connection")
@@ -60,60 +127,576 @@ func (herr *HandlerError) WriteErrorResponse(w io.Writer) error {
 	return nil
 }
 
+// Close closes every listener of s. Connections already accepted are left
+// to finish, see Shutdown.
 func (s *Server) Close() error {
-	err := s.listener.Close()
-	if err != nil {
-		s.closed.Store(false)
-		return errors.New("could not close listener")
-	}
+	s.mu.Lock()
+	listeners := s.listeners
+	s.listeners = nil
+	s.mu.Unlock()
+
 	s.closed.Store(true)
-	return nil
+	var err error
+	for _, l := range listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = errors.New("could not close listener")
+		}
+	}
+	return err
+}
+
+// Addr returns the address of the first listener of s, or nil if it has
+// none. With port 0 or a Unix socket this is where clients should connect.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.listeners) == 0 {
+		return nil
+	}
+	return s.listeners[0].Addr()
+}
+
+// Addrs returns the addresses of all listeners of s, in the order they were
+// added.
+func (s *Server) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addrs := make([]net.Addr, len(s.listeners))
+	for i, l := range s.listeners {
+		addrs[i] = l.Addr()
+	}
+	return addrs
+}
+
+// Shutdown stops accepting connections and waits for the active ones to
+// finish their current request. Idle keep-alive connections are closed right
+// away and active ones are closed once their response is done. If ctx expires
+// first, the contexts of the requests still running are cancelled and their
+// connections closed forcibly; their number is returned along with the
+// context's error.
+func (s *Server) Shutdown(ctx context.Context) (int, error) {
+	s.shuttingDown.Store(true)
+	s.baseContext()
+	if !s.closed.Load() {
+		if err := s.Close(); err != nil {
+			return 0, err
+		}
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() == 0 {
+			return 0, nil
+		}
+		select {
+		case <-ctx.Done():
+			s.cancelBase(ErrServerClosed)
+			return s.closeAllConns(), ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// baseContext returns the context every request context derives from. It is
+// cancelled with ErrServerClosed when Shutdown gives up waiting for requests
+// to finish.
+func (s *Server) baseContext() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.baseCtx == nil {
+		s.baseCtx, s.cancelBase = context.WithCancelCause(context.Background())
+	}
+	return s.baseCtx
+}
+
+// watchConn reads ahead on conn while a handler runs and cancels with
+// ErrClientGone if the client goes away. The stream belongs to the request body until it is done,
+// so the watch only starts then. The returned func stops the watch and must
+// be called before reader is used again.
+func watchConn(conn net.Conn, reader *request.Reader, cancel context.CancelCauseFunc) func() {
+	var mu sync.Mutex
+	stopped := false
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		select {
+		case <-reader.BodyDone():
+		case <-stop:
+			return
+		}
+
+		mu.Lock()
+		if stopped {
+			mu.Unlock()
+			return
+		}
+		// The body's read deadline no longer applies.
+		conn.SetReadDeadline(time.Time{})
+		mu.Unlock()
+
+		err := reader.ReadAhead()
+		var netErr net.Error
+		if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+			cancel(ErrClientGone)
+		}
+	}()
+
+	return func() {
+		mu.Lock()
+		stopped = true
+		close(stop)
+		// A deadline in the past unblocks the pending read.
+		conn.SetReadDeadline(time.Unix(1, 0))
+		mu.Unlock()
+		<-done
+	}
+}
+
+// handshake completes the TLS handshake on conn, within the idle timeout, and
+// returns the negotiated state. It returns nil for a plain connection.
+func (s *Server) handshake(conn net.Conn) (*tls.ConnectionState, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, nil
+	}
+
+	conn.SetDeadline(time.Now().Add(s.idleTimeout()))
+	if err := tlsConn.HandshakeContext(s.baseContext()); err != nil {
+		return nil, err
+	}
+	state := tlsConn.ConnectionState()
+	return &state, nil
+}
+
+// continueReader sends "100 Continue" before the first read of a body whose
+// client is waiting for one. Until then the connection is not kept alive,
+// since a client turned away without it may or may not send the body.
+type continueReader struct {
+	io.ReadCloser
+	w         *response.Writer
+	keepAlive bool
+	sent      bool
+}
+
+func (cr *continueReader) Read(p []byte) (int, error) {
+	if !cr.sent {
+		cr.sent = true
+		// Once a final response has started the client has its answer.
+		if cr.w.Status == response.WriterStatusInit {
+			if err := cr.w.WriteInterim(response.StatusContinue, nil); err != nil {
+				return 0, err
+			}
+			cr.w.SetKeepAlive(cr.keepAlive)
+		}
+	}
+	return cr.ReadCloser.Read(p)
+}
+
+// bodyDone reports whether the body of the last request read by reader is
+// already done, as for a request without one.
+func bodyDone(reader *request.Reader) bool {
+	select {
+	case <-reader.BodyDone():
+		return true
+	default:
+		return false
+	}
+}
+
+// trackConn starts tracking a new connection as idle. It reports false if
+// the server is shutting down and conn should not be served.
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shuttingDown.Load() {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = map[net.Conn]int{}
+	}
+	s.conns[conn] = connStateIdle
+	return true
+}
+
+// setConnState records the state of a tracked connection. It reports false
+// if conn is no longer tracked because Shutdown already closed it.
+func (s *Server) setConnState(conn net.Conn, state int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.conns[conn]; !ok {
+		return false
+	}
+	s.conns[conn] = state
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// closeIdleConns closes every idle connection and returns how many active
+// ones are left.
+func (s *Server) closeIdleConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn, state := range s.conns {
+		if state == connStateIdle {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return len(s.conns)
+}
+
+func (s *Server) closeAllConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.conns)
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+	return n
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+	return DefaultIdleTimeout
+}
+
+func (s *Server) maxRequestsPerConn() int {
+	if s.MaxRequestsPerConn == 0 {
+		return DefaultMaxRequestsPerConn
+	}
+	return s.MaxRequestsPerConn
 }
 
-func (s *Server) handle(conn net.Conn) {
+// limit resolves a size setting where zero picks the default and a negative
+// value disables the limit.
+func limit(value, def int) int {
+	switch {
+	case value == 0:
+		return def
+	case value < 0:
+		return 0
+	}
+	return value
+}
+
+// deadline returns the time timeout after start, or the zero time (no
+// deadline) when timeout is not set.
+func deadline(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
+
+// readErrorCode picks the status to answer a request that failed to parse,
+// the one carried by a request.ParseError or 408 for a read timeout.
+func readErrorCode(err error) response.StatusCode {
+	var netErr net.Error
+	var parseErr *request.ParseError
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return response.StatusRequestTimeout
+	case errors.As(err, &parseErr):
+		return response.StatusCode(parseErr.Status)
+	}
+	return response.StatusBadRequest
+}
+
+// isReadError reports whether err is a failure to read a request, as opposed
+// to one of the connection.
+func isReadError(err error) bool {
+	var netErr net.Error
+	var parseErr *request.ParseError
+	return errors.As(err, &parseErr) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// writeReadError answers a request that failed to parse. The client only
+// gets the generic reason phrase, the cause is logged.
+func writeReadError(conn net.Conn, err error) {
+	code := readErrorCode(err)
+	message := response.StatusText(code)
+	log.Printf("rejecting request from %s with %d: %v", conn.RemoteAddr(), code, err)
+
+	// The read deadline may be what failed, the answer still gets its own
+	// chance to go out.
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	herr := &HandlerError{
+		Code:    code,
+		Message: message,
+	}
+	herr.WriteErrorResponse(conn)
+}
+
+func (s *Server) handle(conn net.Conn, h Handler) {
 	defer conn.Close()
-	req, err := request.RequestFromReader(conn)
+	if !s.trackConn(conn) {
+		return
+	}
+	defer s.untrackConn(conn)
+
+	tlsState, err := s.handshake(conn)
 	if err != nil {
-		herr := &HandlerError{
-			Code:    response.StatusBadRequest,
-			Message: err.Error(),
-		}
-		herr.WriteErrorResponse(conn)
+		log.Printf("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
 		return
 	}
 
-	w := response.NewWriter(conn)
-	s.handler(w, req)
+	// The reader outlives each request so that pipelined bytes read past the
+	// end of one request are parsed as the next.
+	reader := request.NewReader(conn)
+	reader.MaxHeaderBytes = limit(s.MaxHeaderBytes, DefaultMaxHeaderBytes)
+	reader.MaxBodyBytes = max(s.MaxBodyBytes, 0)
+	reader.Strict = s.StrictParsing
+	maxRequests := s.maxRequestsPerConn()
+
+	for served := 0; maxRequests < 0 || served < maxRequests; served++ {
+		conn.SetReadDeadline(time.Now().Add(s.idleTimeout()))
+		conn.SetWriteDeadline(time.Time{})
+		if err := reader.WaitForRequest(); err != nil {
+			// Nothing of a request arrived, so there is nobody to answer.
+			return
+		}
+		// From its first byte on, a request is answered or counted as
+		// forced closed by Shutdown.
+		if !s.setConnState(conn, connStateActive) {
+			return
+		}
+
+		start := time.Now()
+		headerDeadline := deadline(start, s.ReadHeaderTimeout)
+		bodyDeadline := deadline(start, s.ReadTimeout)
+		if headerDeadline.IsZero() || (!bodyDeadline.IsZero() && bodyDeadline.Before(headerDeadline)) {
+			headerDeadline = bodyDeadline
+		}
+
+		conn.SetReadDeadline(headerDeadline)
+		req, err := reader.ReadRequestHeader()
+		if err != nil {
+			writeReadError(conn, err)
+			return
+		}
+		req.TLS = tlsState
+		req.RemoteAddr = conn.RemoteAddr().String()
+
+		// The handler reads the body straight off the connection, under the
+		// remaining read deadline.
+		conn.SetReadDeadline(bodyDeadline)
+		body := req.Body
+		conn.SetWriteDeadline(deadline(time.Now(), s.WriteTimeout))
+
+		// Expectations are an HTTP/1.1 feature, a 1.0 client's are ignored.
+		expectContinue := req.ProtoAtLeast(1, 1) && req.ExpectsContinue()
+		if req.ProtoAtLeast(1, 1) && req.Header.Get("Expect") != "" && !expectContinue {
+			herr := &HandlerError{
+				Code:    response.StatusExpectationFailed,
+				Message: response.StatusText(response.StatusExpectationFailed),
+			}
+			herr.WriteErrorResponse(conn)
+			return
+		}
+
+		ctx, cancel := context.WithCancelCause(s.baseContext())
+		req = req.WithContext(ctx)
+		stopWatch := watchConn(conn, reader, cancel)
+
+		w := response.NewWriter(conn)
+		w.SetRequestVersion(req.RequestLine.HttpVersion)
+		w.SetRequestMethod(req.RequestLine.Method)
+		keepAlive := req.KeepAlive() && (maxRequests < 0 || served+1 < maxRequests) &&
+			!s.shuttingDown.Load()
+		w.SetKeepAlive(keepAlive)
+		var cr *continueReader
+		if expectContinue && !bodyDone(reader) {
+			w.SetKeepAlive(false)
+			cr = &continueReader{ReadCloser: body, w: w, keepAlive: keepAlive}
+			req.Body = cr
+		}
+
+		ok := s.serveRequest(conn, w, req, h)
+		// A client still waiting for 100 Continue may never send the body,
+		// so it is not drained and the connection closes after the response.
+		drain := cr == nil || cr.sent
+		// A handler that gives up on a body breaking a limit or timing out
+		// leaves the answer to the server, as if it had failed to parse.
+		if drain && ok && w.Status == response.WriterStatusInit {
+			if err := body.Close(); isReadError(err) {
+				writeReadError(conn, err)
+				ok = false
+			}
+		}
+		// Whatever body the handler left unread is discarded, or the
+		// connection is given up if that is too much.
+		reuse := drain && ok && w.KeepAlive() && !s.shuttingDown.Load() && body.Close() == nil
+		stopWatch()
+		cancel(nil)
+		if !reuse {
+			return
+		}
+		if !s.setConnState(conn, connStateIdle) {
+			return
+		}
+	}
+}
+
+// serveRequest runs the handler, recovering from a panic so that it only
+// takes down its own connection. It reports false if the handler panicked.
+func (s *Server) serveRequest(conn net.Conn, w *response.Writer, req *request.Request, h Handler) (ok bool) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		ok = false
+
+		stack := debug.Stack()
+		log.Printf("panic serving %s: %v\n%s", conn.RemoteAddr(), rec, stack)
+		if s.PanicHook != nil {
+			s.PanicHook(req, rec, stack)
+		}
+
+		// Once the status line is out there is no way to signal the error,
+		// the connection is simply closed.
+		if w.Status == response.WriterStatusInit {
+			herr := &HandlerError{
+				Code:    response.StatusInternalServerError,
+				Message: response.StatusText(response.StatusInternalServerError),
+			}
+			herr.WriteErrorResponse(conn)
+		}
+	}()
+
+	h(w, req)
+	return true
 }
 
-func (s *Server) listen() {
-	for !s.closed.Load() {
-		conn, err := s.listener.Accept()
+func (s *Server) listen(l net.Listener, h Handler) {
+	for {
+		conn, err := l.Accept()
 		if err != nil {
-			if s.closed.Load() {
+			if s.closed.Load() || errors.Is(err, net.ErrClosed) {
 				return
 			}
 			log.Printf("Failed to accept request: %s", err.Error())
 			continue
 		}
 		log.Printf("Accepted connection from %s\n", conn.RemoteAddr())
-		go s.handle(conn)
+		go s.handle(conn, h)
 	}
 }
 
-func Serve(port int, h Handler) (*Server, error) {
+// Serve binds port on all interfaces and starts accepting connections in the
+// background, dispatching every request to h. Port is set to the bound port,
+// which matters for port 0. Fields on s should be set before calling it.
+func (s *Server) Serve(port int, h Handler) error {
+	listener, err := s.listenPort(port)
+	if err != nil {
+		return err
+	}
+	return s.ServeListener(listener, h)
+}
+
+// ServeTLS is like Serve for HTTPS. The certificate comes from certFile and
+// keyFile, which are reloaded when they change on disk, or from TLSConfig
+// when both are empty.
+func (s *Server) ServeTLS(port int, h Handler, certFile, keyFile string) error {
+	config, err := s.tlsConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	listener, err := s.listenPort(port)
+	if err != nil {
+		return err
+	}
+	return s.ServeListener(tls.NewListener(listener, config), h)
+}
+
+func (s *Server) listenPort(port int) (net.Listener, error) {
 	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
 	if err != nil {
-		return &Server{}, fmt.Errorf("failed to listen at address %v : %s", port, err.Error())
+		return nil, fmt.Errorf("failed to listen at address %v : %s", port, err.Error())
 	}
+	s.Port = listener.Addr().(*net.TCPAddr).Port
+	return listener, nil
+}
 
-	s := NewServer()
-	s.Port = port
-	s.handler = h
-	s.listener = listener
+// ServeAddr listens on addr, e.g. "tcp://127.0.0.1:0" or
+// "unix:///run/app.sock", and serves it like Serve. See Listen for the
+// accepted forms.
+func (s *Server) ServeAddr(addr string, h Handler) error {
+	listener, err := Listen(addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen at address %v : %w", addr, err)
+	}
+	return s.ServeListener(listener, h)
+}
+
+// ServeListener accepts connections from l in the background and dispatches
+// their requests to h. A server can serve several listeners at once, each
+// with its own handler. l is closed by Close and Shutdown, and right away if
+// s is already shut down.
+func (s *Server) ServeListener(l net.Listener, h Handler) error {
+	s.mu.Lock()
+	if s.shuttingDown.Load() {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners = append(s.listeners, l)
 	s.closed.Store(false)
+	s.mu.Unlock()
 
-	go s.listen()
+	go s.listen(l, h)
+	return nil
+}
 
+// ServeListenerTLS is like ServeListener for HTTPS, with the certificate
+// taken as in ServeTLS.
+func (s *Server) ServeListenerTLS(l net.Listener, h Handler, certFile, keyFile string) error {
+	config, err := s.tlsConfig(certFile, keyFile)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	return s.ServeListener(tls.NewListener(l, config), h)
+}
+
+func Serve(port int, h Handler) (*Server, error) {
+	s := NewServer()
+	if err := s.Serve(port, h); err != nil {
+		return &Server{}, err
+	}
+	return s, nil
+}
+
+func ServeTLS(port int, h Handler, certFile, keyFile string) (*Server, error) {
+	s := NewServer()
+	if err := s.ServeTLS(port, h, certFile, keyFile); err != nil {
+		return &Server{}, err
+	}
+	return s, nil
+}
+
+func ServeAddr(addr string, h Handler) (*Server, error) {
+	s := NewServer()
+	if err := s.ServeAddr(addr, h); err != nil {
+		return &Server{}, err
+	}
 	return s, nil
 }
@@ -0,0 +1,714 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoTarget(w *response.Writer, req *request.Request) {
+	body := []byte(req.RequestLine.RequestTarget)
+	h := response.GetDefaultHeaders(len(body))
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+// readResponse reads a single response with a Content-Length body off r.
+func readResponse(t *testing.T, r *bufio.Reader) (string, map[string]string, string) {
+	t.Helper()
+	status, err := r.ReadString('\n')
+	require.NoError(t, err)
+
+	fields := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		key, value, _ := strings.Cut(strings.TrimSuffix(line, "\r\n"), ": ")
+		fields[strings.ToLower(key)] = value
+	}
+
+	cl, err := strconv.Atoi(fields["content-length"])
+	require.NoError(t, err)
+	body := make([]byte, cl)
+	_, err = io.ReadFull(r, body)
+	require.NoError(t, err)
+
+	return status, fields, string(body)
+}
+
+func TestHandleKeepAlive(t *testing.T) {
+	// Test: Several requests on one connection, the last one closing it
+	client, conn := net.Pipe()
+	s := &Server{}
+	done := make(chan struct{})
+	go func() {
+		s.handle(conn, echoTarget)
+		close(done)
+	}()
+
+	go client.Write([]byte("GET /one HTTP/1.1\r\nHost: x\r\n\r\n" +
+		"GET /two HTTP/1.1\r\nHost: x\r\n\r\n" +
+		"GET /three HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"))
+
+	r := bufio.NewReader(client)
+	status, h, body := readResponse(t, r)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+	assert.Equal(t, "keep-alive", h["connection"])
+	assert.Equal(t, "/one", body)
+
+	_, h, body = readResponse(t, r)
+	assert.Equal(t, "keep-alive", h["connection"])
+	assert.Equal(t, "/two", body)
+
+	_, h, body = readResponse(t, r)
+	assert.Equal(t, "close", h["connection"])
+	assert.Equal(t, "/three", body)
+
+	<-done
+	client.Close()
+
+	// Test: MaxRequestsPerConn closes after the limit
+	client, conn = net.Pipe()
+	s = &Server{MaxRequestsPerConn: 1}
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn, echoTarget)
+		close(done)
+	}()
+
+	go client.Write([]byte("GET /only HTTP/1.1\r\nHost: x\r\n\r\n"))
+
+	r = bufio.NewReader(client)
+	_, h, body = readResponse(t, r)
+	assert.Equal(t, "close", h["connection"])
+	assert.Equal(t, "/only", body)
+
+	<-done
+	client.Close()
+}
+
+func TestHandlePanic(t *testing.T) {
+	// Test: Panic before the status line sends a 500 and calls the hook
+	client, conn := net.Pipe()
+	var hooked any
+	handler := func(w *response.Writer, req *request.Request) {
+		panic("boom")
+	}
+	s := &Server{
+		PanicHook: func(req *request.Request, rec any, stack []byte) {
+			hooked = rec
+			assert.NotEmpty(t, stack)
+		},
+	}
+	done := make(chan struct{})
+	go func() {
+		s.handle(conn, handler)
+		close(done)
+	}()
+
+	go client.Write([]byte("GET /panic HTTP/1.1\r\nHost: x\r\n\r\n"))
+
+	status, h, body := readResponse(t, bufio.NewReader(client))
+	assert.Equal(t, "HTTP/1.1 500 Internal Server Error\r\n", status)
+	assert.Equal(t, "close", h["connection"])
+	assert.Equal(t, "Internal Server Error", body)
+
+	<-done
+	assert.Equal(t, "boom", hooked)
+	client.Close()
+
+	// Test: Panic after the status line just closes the connection
+	client, conn = net.Pipe()
+	handler = func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		panic("late boom")
+	}
+	s = &Server{}
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn, handler)
+		close(done)
+	}()
+
+	go client.Write([]byte("GET /panic HTTP/1.1\r\nHost: x\r\n\r\n"))
+
+	rest, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", string(rest))
+
+	<-done
+}
+
+func TestShutdown(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	s := NewServer()
+	require.NoError(t, s.Serve(0, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		echoTarget(w, req)
+	}))
+	addr := s.Addr().String()
+
+	// Test: Idle keep-alive connections are closed, active ones drain
+	idle, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer idle.Close()
+	idle.Write([]byte("GET /fast HTTP/1.1\r\nHost: x\r\n\r\n"))
+	_, _, body := readResponse(t, bufio.NewReader(idle))
+	assert.Equal(t, "/fast", body)
+
+	active, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer active.Close()
+	active.Write([]byte("GET /slow HTTP/1.1\r\nHost: x\r\n\r\n"))
+	<-started
+
+	type result struct {
+		forced int
+		err    error
+	}
+	res := make(chan result)
+	go func() {
+		forced, err := s.Shutdown(context.Background())
+		res <- result{forced, err}
+	}()
+
+	_, err = idle.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	close(release)
+	ar := bufio.NewReader(active)
+	_, _, body = readResponse(t, ar)
+	assert.Equal(t, "/slow", body)
+	_, err = ar.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	r := <-res
+	require.NoError(t, r.err)
+	assert.Equal(t, 0, r.forced)
+
+	_, err = net.Dial("tcp", addr)
+	require.Error(t, err)
+
+	// Test: A request whose headers are still arriving is answered
+	s = NewServer()
+	require.NoError(t, s.Serve(0, echoTarget))
+	partial, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer partial.Close()
+	partial.Write([]byte("GET /partial HTTP/1.1\r\nHost: x\r\n"))
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, state := range s.conns {
+			if state == connStateActive {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 5*time.Millisecond)
+
+	go func() {
+		forced, err := s.Shutdown(context.Background())
+		res <- result{forced, err}
+	}()
+	partial.Write([]byte("\r\n"))
+	_, _, body = readResponse(t, bufio.NewReader(partial))
+	assert.Equal(t, "/partial", body)
+	r = <-res
+	require.NoError(t, r.err)
+	assert.Equal(t, 0, r.forced)
+
+	// Test: Connections still active at the deadline are forced closed
+	block := make(chan struct{})
+	defer close(block)
+	s = NewServer()
+	require.NoError(t, s.Serve(0, func(w *response.Writer, req *request.Request) {
+		started <- struct{}{}
+		<-block
+	}))
+	stuck, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer stuck.Close()
+	stuck.Write([]byte("GET /stuck HTTP/1.1\r\nHost: x\r\n\r\n"))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	forced, err := s.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, forced)
+}
+
+func TestHandleLimits(t *testing.T) {
+	cases := []struct {
+		name    string
+		server  *Server
+		handler Handler
+		raw     string
+		status  string
+	}{
+		{
+			name:    "Header section too large",
+			server:  &Server{MaxHeaderBytes: 64},
+			handler: echoTarget,
+			raw:     "GET / HTTP/1.1\r\nX-Padding: " + strings.Repeat("a", 100) + "\r\n\r\n",
+			status:  "HTTP/1.1 431 Request Header Fields Too Large\r\n",
+		},
+		{
+			name:    "Body too large",
+			server:  &Server{MaxBodyBytes: 10},
+			handler: echoTarget,
+			raw:     "POST / HTTP/1.1\r\nContent-Length: 20\r\n\r\n" + strings.Repeat("b", 20),
+			status:  "HTTP/1.1 413 Content Too Large\r\n",
+		},
+		{
+			name:    "Headers never finish",
+			server:  &Server{ReadHeaderTimeout: 50 * time.Millisecond},
+			handler: echoTarget,
+			raw:     "GET / HTTP/1.1\r\nHost: x\r\n",
+			status:  "HTTP/1.1 408 Request Timeout\r\n",
+		},
+		{
+			name:    "Body never finishes",
+			server:  &Server{ReadTimeout: 50 * time.Millisecond},
+			handler: echoBody,
+			raw:     "POST / HTTP/1.1\r\nContent-Length: 20\r\n\r\nshort",
+			status:  "HTTP/1.1 408 Request Timeout\r\n",
+		},
+		{
+			name:    "Chunked body too large",
+			server:  &Server{MaxBodyBytes: 10},
+			handler: echoBody,
+			raw:     "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n8\r\n12345678\r\n8\r\n12345678\r\n0\r\n\r\n",
+			status:  "HTTP/1.1 413 Content Too Large\r\n",
+		},
+	}
+
+	for _, tc := range cases {
+		// Test: Limit violations get their own status
+		client, conn := net.Pipe()
+		done := make(chan struct{})
+		go func() {
+			tc.server.handle(conn, tc.handler)
+			close(done)
+		}()
+
+		go client.Write([]byte(tc.raw))
+
+		status, _, _ := readResponse(t, bufio.NewReader(client))
+		assert.Equal(t, tc.status, status, tc.name)
+
+		<-done
+		client.Close()
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	// Test: Client going away cancels the request context
+	client, conn := net.Pipe()
+	cancelled := make(chan error)
+	handler := func(w *response.Writer, req *request.Request) {
+		<-req.Context().Done()
+		cancelled <- context.Cause(req.Context())
+	}
+	s := &Server{}
+	done := make(chan struct{})
+	go func() {
+		s.handle(conn, handler)
+		close(done)
+	}()
+
+	_, err := client.Write([]byte("GET /wait HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+	client.Close()
+	assert.ErrorIs(t, <-cancelled, ErrClientGone)
+	<-done
+
+	// Test: Pipelined bytes read while watching are kept
+	client, conn = net.Pipe()
+	s = &Server{}
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn, echoTarget)
+		close(done)
+	}()
+
+	go client.Write([]byte("GET /one HTTP/1.1\r\nHost: x\r\n\r\n" +
+		"GET /two HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"))
+	r := bufio.NewReader(client)
+	_, _, body := readResponse(t, r)
+	assert.Equal(t, "/one", body)
+	_, _, body = readResponse(t, r)
+	assert.Equal(t, "/two", body)
+	<-done
+	client.Close()
+
+	// Test: Graceful shutdown leaves running requests their context
+	s = NewServer()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ctxErr := make(chan error, 1)
+	require.NoError(t, s.Serve(0, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+		ctxErr <- req.Context().Err()
+		echoTarget(w, req)
+	}))
+	c, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	c.Write([]byte("GET /shutdown HTTP/1.1\r\nHost: x\r\n\r\n"))
+	<-started
+
+	type result struct {
+		forced int
+		err    error
+	}
+	res := make(chan result)
+	go func() {
+		forced, err := s.Shutdown(context.Background())
+		res <- result{forced, err}
+	}()
+	require.Eventually(t, s.shuttingDown.Load, time.Second, 5*time.Millisecond)
+	time.Sleep(2 * shutdownPollInterval)
+	close(release)
+	assert.NoError(t, <-ctxErr)
+	_, _, body = readResponse(t, bufio.NewReader(c))
+	assert.Equal(t, "/shutdown", body)
+	sr := <-res
+	require.NoError(t, sr.err)
+	assert.Equal(t, 0, sr.forced)
+
+	// Test: Shutdown running out of time cancels the request context
+	s = NewServer()
+	started = make(chan struct{})
+	require.NoError(t, s.Serve(0, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-req.Context().Done()
+		ctxErr <- context.Cause(req.Context())
+	}))
+	c2, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer c2.Close()
+	c2.Write([]byte("GET /stuck HTTP/1.1\r\nHost: x\r\n\r\n"))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	forced, err := s.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, forced)
+	assert.ErrorIs(t, <-ctxErr, ErrServerClosed)
+}
+
+// echoBody answers with the request body, and leaves the answer to the
+// server if reading it fails.
+func echoBody(w *response.Writer, req *request.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return
+	}
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func TestHandleStreamingBody(t *testing.T) {
+	// Test: Handler runs before the body arrives
+	client, conn := net.Pipe()
+	started := make(chan struct{})
+	handler := func(w *response.Writer, req *request.Request) {
+		close(started)
+		echoBody(w, req)
+	}
+	s := &Server{}
+	done := make(chan struct{})
+	go func() {
+		s.handle(conn, handler)
+		close(done)
+	}()
+
+	_, err := client.Write([]byte("POST /upload HTTP/1.1\r\nHost: x\r\nContent-Length: 11\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+	go client.Write([]byte("hello world"))
+	_, _, body := readResponse(t, bufio.NewReader(client))
+	assert.Equal(t, "hello world", body)
+	<-done
+	client.Close()
+
+	// Test: Bodies have no size limit unless one is set
+	client, conn = net.Pipe()
+	s = &Server{}
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn, func(w *response.Writer, req *request.Request) {
+			n, err := io.Copy(io.Discard, req.Body)
+			if err != nil {
+				return
+			}
+			body := []byte(strconv.FormatInt(n, 10))
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+			w.WriteBody(body)
+		})
+		close(done)
+	}()
+
+	const size = 16 << 20
+	go func() {
+		client.Write([]byte("POST /upload HTTP/1.1\r\nHost: x\r\nConnection: close\r\n" +
+			"Content-Length: " + strconv.Itoa(size) + "\r\n\r\n"))
+		client.Write(make([]byte, size))
+	}()
+	status, _, body := readResponse(t, bufio.NewReader(client))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+	assert.Equal(t, strconv.Itoa(size), body)
+	<-done
+	client.Close()
+
+	// Test: Unread body is discarded before the next request
+	client, conn = net.Pipe()
+	s = &Server{}
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn, echoTarget)
+		close(done)
+	}()
+
+	go client.Write([]byte("POST /one HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5\r\nhello\r\n0\r\n\r\n" +
+		"GET /two HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"))
+	r := bufio.NewReader(client)
+	_, h, body := readResponse(t, r)
+	assert.Equal(t, "keep-alive", h["connection"])
+	assert.Equal(t, "/one", body)
+	_, _, body = readResponse(t, r)
+	assert.Equal(t, "/two", body)
+	<-done
+	client.Close()
+
+	// Test: Body that never finishes fails the read and closes the connection
+	client, conn = net.Pipe()
+	s = &Server{ReadTimeout: 50 * time.Millisecond}
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn, echoBody)
+		close(done)
+	}()
+
+	go client.Write([]byte("POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 20\r\n\r\nshort"))
+	r = bufio.NewReader(client)
+	status, _, _ = readResponse(t, r)
+	assert.Equal(t, "HTTP/1.1 408 Request Timeout\r\n", status)
+	<-done
+	_, err = r.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	client.Close()
+}
+
+func TestHandleExpectContinue(t *testing.T) {
+	// Test: 100 Continue goes out when the handler reads the body
+	client, conn := net.Pipe()
+	s := &Server{}
+	done := make(chan struct{})
+	go func() {
+		s.handle(conn, echoBody)
+		close(done)
+	}()
+
+	_, err := client.Write([]byte("POST /upload HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n"))
+	require.NoError(t, err)
+	r := bufio.NewReader(client)
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+	line, err = r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", line)
+
+	go client.Write([]byte("hello" + "POST /next HTTP/1.1\r\nHost: x\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok"))
+	status, h, body := readResponse(t, r)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+	assert.Equal(t, "keep-alive", h["connection"])
+	assert.Equal(t, "hello", body)
+	_, _, body = readResponse(t, r)
+	assert.Equal(t, "ok", body)
+	<-done
+	client.Close()
+
+	// Test: Handler rejects without reading, no 100 and no reuse
+	client, conn = net.Pipe()
+	handler := func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusExpectationFailed)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	}
+	s = &Server{}
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn, handler)
+		close(done)
+	}()
+
+	go client.Write([]byte("PUT /big HTTP/1.1\r\nHost: x\r\nContent-Length: 1000000\r\nExpect: 100-continue\r\n\r\n"))
+	r = bufio.NewReader(client)
+	status, h, _ = readResponse(t, r)
+	assert.Equal(t, "HTTP/1.1 417 Expectation Failed\r\n", status)
+	assert.Equal(t, "close", h["connection"])
+	<-done
+	client.Close()
+
+	// Test: Handler ignoring the body closes without waiting for it
+	client, conn = net.Pipe()
+	s = &Server{}
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn, func(w *response.Writer, req *request.Request) {})
+		close(done)
+	}()
+
+	_, err = client.Write([]byte("POST /upload HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = client.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	<-done
+	client.Close()
+
+	// Test: Unknown expectations are refused
+	client, conn = net.Pipe()
+	s = &Server{}
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn, echoBody)
+		close(done)
+	}()
+
+	go client.Write([]byte("POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 2\r\nExpect: something-else\r\n\r\nhi"))
+	status, _, _ = readResponse(t, bufio.NewReader(client))
+	assert.Equal(t, "HTTP/1.1 417 Expectation Failed\r\n", status)
+	<-done
+	client.Close()
+}
+
+func TestHandleHTTPVersions(t *testing.T) {
+	// Test: HTTP/1.0 gets a 1.0 answer and a closed connection
+	client, conn := net.Pipe()
+	s := &Server{}
+	done := make(chan struct{})
+	go func() {
+		s.handle(conn, echoTarget)
+		close(done)
+	}()
+
+	go client.Write([]byte("GET /old HTTP/1.0\r\n\r\n"))
+	r := bufio.NewReader(client)
+	status, h, body := readResponse(t, r)
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n", status)
+	assert.Equal(t, "close", h["connection"])
+	assert.Equal(t, "/old", body)
+	<-done
+	client.Close()
+
+	// Test: HTTP/1.0 keep-alive when asked for
+	client, conn = net.Pipe()
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn, echoTarget)
+		close(done)
+	}()
+
+	go client.Write([]byte("GET /one HTTP/1.0\r\nConnection: keep-alive\r\n\r\n" +
+		"GET /two HTTP/1.0\r\n\r\n"))
+	r = bufio.NewReader(client)
+	_, h, body = readResponse(t, r)
+	assert.Equal(t, "keep-alive", h["connection"])
+	assert.Equal(t, "/one", body)
+	_, h, body = readResponse(t, r)
+	assert.Equal(t, "close", h["connection"])
+	assert.Equal(t, "/two", body)
+	<-done
+	client.Close()
+
+	// Test: A HEAD response keeps the connection for the next request
+	client, conn = net.Pipe()
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn, echoTarget)
+		close(done)
+	}()
+
+	go client.Write([]byte("HEAD /one HTTP/1.1\r\nHost: x\r\n\r\n" +
+		"GET /two HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"))
+	out, err := io.ReadAll(client)
+	require.NoError(t, err)
+	head, rest, _ := strings.Cut(string(out), "\r\n\r\n")
+	assert.Contains(t, head, "Content-Length: 4\r\nConnection: keep-alive")
+	assert.True(t, strings.HasPrefix(rest, "HTTP/1.1 200 OK\r\n"), rest)
+	assert.True(t, strings.HasSuffix(rest, "\r\n\r\n/two"), rest)
+	<-done
+	client.Close()
+
+	// Test: Unknown major versions get a 505
+	client, conn = net.Pipe()
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn, echoTarget)
+		close(done)
+	}()
+
+	go client.Write([]byte("GET / HTTP/2.0\r\nHost: x\r\n\r\n"))
+	status, _, _ = readResponse(t, bufio.NewReader(client))
+	assert.Equal(t, "HTTP/1.1 505 HTTP Version Not Supported\r\n", status)
+	<-done
+	client.Close()
+}
+
+func TestHandleParseErrors(t *testing.T) {
+	cases := []struct {
+		raw    string
+		status string
+		body   string
+	}{
+		{"GET /\r\n\r\n", "HTTP/1.1 400 Bad Request\r\n", "Bad Request"},
+		{"GET / HTTP/1.1\r\nBad Header\r\n\r\n", "HTTP/1.1 400 Bad Request\r\n", "Bad Request"},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n", "HTTP/1.1 501 Not Implemented\r\n", "Not Implemented"},
+		{"GET / HTTP/3.0\r\n\r\n", "HTTP/1.1 505 HTTP Version Not Supported\r\n", "HTTP Version Not Supported"},
+	}
+
+	for _, tc := range cases {
+		// Test: Status from the error, generic body without the cause
+		client, conn := net.Pipe()
+		s := &Server{}
+		done := make(chan struct{})
+		go func() {
+			s.handle(conn, echoTarget)
+			close(done)
+		}()
+
+		go client.Write([]byte(tc.raw))
+		status, h, body := readResponse(t, bufio.NewReader(client))
+		assert.Equal(t, tc.status, status, tc.raw)
+		assert.Equal(t, tc.body, body, tc.raw)
+		assert.Equal(t, "close", h["connection"], tc.raw)
+		<-done
+		client.Close()
+	}
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often a CertStore looks at its files for changes.
+const certCheckInterval = time.Second
+
+var ErrNoCertificate = errors.New("error: no TLS certificate configured")
+
+// CertStore holds certificate and key pairs loaded from disk and picks one
+// per handshake by the SNI server name. The files are checked for changes at
+// most once every second and reloaded in place, so renewed certificates are
+// served without a restart. Plug GetCertificate into a tls.Config.
+type CertStore struct {
+	mu            sync.RWMutex
+	certs         []*storedCert
+	checkInterval time.Duration
+}
+
+type storedCert struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	names    []string
+	modTime  time.Time
+	checked  time.Time
+}
+
+func NewCertStore() *CertStore {
+	return &CertStore{checkInterval: certCheckInterval}
+}
+
+// Add loads a PEM certificate and key pair. It is selected for the DNS names
+// of the certificate, or its common name when it has none; "*.example.com"
+// matches one label. The first pair added also serves clients that send no
+// server name or one no pair matches.
+func (cs *CertStore) Add(certFile, keyFile string) error {
+	sc := &storedCert{certFile: certFile, keyFile: keyFile, checked: time.Now()}
+	if err := sc.load(); err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	cs.certs = append(cs.certs, sc)
+	cs.mu.Unlock()
+	return nil
+}
+
+// Reload reloads every pair from disk right away, e.g. on SIGHUP. A pair that
+// fails to load keeps its previous certificate; the first error is returned.
+func (cs *CertStore) Reload() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var err error
+	for _, sc := range cs.certs {
+		sc.checked = time.Now()
+		if lerr := sc.load(); lerr != nil && err == nil {
+			err = lerr
+		}
+	}
+	return err
+}
+
+// GetCertificate returns the certificate for hello's server name, reloading
+// the ones whose files changed since they were last loaded.
+func (cs *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.reloadChanged()
+
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if len(cs.certs) == 0 {
+		return nil, ErrNoCertificate
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		// An exact name wins over a wildcard, whatever the order of Add.
+		for _, sc := range cs.certs {
+			for _, n := range sc.names {
+				if n == name {
+					return sc.cert, nil
+				}
+			}
+		}
+		for _, sc := range cs.certs {
+			for _, n := range sc.names {
+				if matchWildcard(n, name) {
+					return sc.cert, nil
+				}
+			}
+		}
+	}
+	return cs.certs[0].cert, nil
+}
+
+// reloadChanged reloads the pairs not checked for checkInterval whose files
+// were modified. A failed load is logged and the previous certificate kept,
+// as the files may have been caught halfway through being replaced.
+func (cs *CertStore) reloadChanged() {
+	now := time.Now()
+
+	cs.mu.RLock()
+	due := false
+	for _, sc := range cs.certs {
+		if now.Sub(sc.checked) >= cs.checkInterval {
+			due = true
+			break
+		}
+	}
+	cs.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, sc := range cs.certs {
+		if now.Sub(sc.checked) < cs.checkInterval {
+			continue
+		}
+		sc.checked = now
+
+		modTime, err := latestModTime(sc.certFile, sc.keyFile)
+		if err != nil || modTime.Equal(sc.modTime) {
+			continue
+		}
+		if err := sc.load(); err != nil {
+			log.Printf("Keeping previous certificate: %v", err)
+		}
+	}
+}
+
+func (sc *storedCert) load() error {
+	modTime, err := latestModTime(sc.certFile, sc.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s: %w", sc.certFile, err)
+	}
+	cert, err := tls.LoadX509KeyPair(sc.certFile, sc.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s: %w", sc.certFile, err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("failed to load certificate %s: %w", sc.certFile, err)
+		}
+	}
+
+	sc.cert = &cert
+	sc.names = certNames(cert.Leaf)
+	sc.modTime = modTime
+	return nil
+}
+
+// certNames returns the lowercased names leaf is valid for.
+func certNames(leaf *x509.Certificate) []string {
+	names := leaf.DNSNames
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = []string{leaf.Subject.CommonName}
+	}
+
+	lower := make([]string, len(names))
+	for i, n := range names {
+		lower[i] = strings.ToLower(n)
+	}
+	return lower
+}
+
+// matchWildcard reports whether pattern is a wildcard name such as
+// "*.example.com" covering name in its leftmost label only.
+func matchWildcard(pattern, name string) bool {
+	suffix, ok := strings.CutPrefix(pattern, "*")
+	if !ok || !strings.HasPrefix(suffix, ".") {
+		return false
+	}
+	label, rest, ok := strings.Cut(name, ".")
+	return ok && label != "" && "."+rest == suffix
+}
+
+// latestModTime returns the most recent modification time of files.
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// tlsConfig builds the configuration ServeTLS listens with: a copy of
+// s.TLSConfig, serving certFile and keyFile when they are given.
+func (s *Server) tlsConfig(certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+
+	if certFile != "" || keyFile != "" {
+		store := NewCertStore()
+		if err := store.Add(certFile, keyFile); err != nil {
+			return nil, err
+		}
+		config.GetCertificate = store.GetCertificate
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, ErrNoCertificate
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"http/1.1"}
+	}
+	return config, nil
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shubh-man007/TinyProto/internal/request"
+	"github.com/shubh-man007/TinyProto/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert generates a self-signed certificate for names, usable by servers
+// and clients and as its own CA, and writes it and its key to dir as
+// PEM files named after base.
+func writeCert(t *testing.T, dir, base, cn string, names ...string) (certFile, keyFile string, cert tls.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              names,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	certFile = filepath.Join(dir, base+".crt")
+	keyFile = filepath.Join(dir, base+".key")
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	return certFile, keyFile, cert
+}
+
+// echoTLS answers with the TLS version, cipher suite and client certificate
+// common name of the connection.
+func echoTLS(w *response.Writer, req *request.Request) {
+	body := []byte("plain")
+	if req.TLS != nil {
+		peer := "-"
+		if len(req.TLS.PeerCertificates) > 0 {
+			peer = req.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		body = []byte(fmt.Sprintf("%s %s %s", tls.VersionName(req.TLS.Version), tls.CipherSuiteName(req.TLS.CipherSuite), peer))
+	}
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+// getTLS sends one request over a TLS connection to s and returns the body.
+func getTLS(t *testing.T, s *Server, config *tls.Config) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", s.Addr().String(), config)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	status, _, body := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+	return body
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, cert := writeCert(t, dir, "server", "localhost", "localhost")
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+
+	// Test: Cert and key files, the handler sees the negotiated connection
+	s, err := ServeTLS(0, echoTLS, certFile, keyFile)
+	require.NoError(t, err)
+	defer s.Close()
+
+	body := getTLS(t, s, &tls.Config{RootCAs: roots, ServerName: "localhost", MaxVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}})
+	assert.Equal(t, "TLS 1.2 TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 -", body)
+
+	body = getTLS(t, s, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	assert.Contains(t, body, "TLS 1.3 ")
+
+	// Test: A configuration without any certificate is refused
+	_, err = ServeTLS(0, echoTLS, "", "")
+	assert.ErrorIs(t, err, ErrNoCertificate)
+
+	// Test: A missing key file is reported
+	_, err = ServeTLS(0, echoTLS, certFile, filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+
+	// Test: TLSConfig requiring a client certificate
+	_, _, clientCert := writeCert(t, dir, "client", "alice")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert.Leaf)
+	s2 := NewServer()
+	s2.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	require.NoError(t, s2.ServeTLS(0, echoTLS, "", ""))
+	defer s2.Close()
+
+	body = getTLS(t, s2, &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{clientCert}})
+	assert.Contains(t, body, " alice")
+
+	// Test: A client without a certificate fails the handshake
+	conn, err := tls.Dial("tcp", s2.Addr().String(), &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err == nil {
+		// With TLS 1.3 the rejection arrives on the first read.
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	assert.Error(t, err)
+}
+
+func TestCertStore(t *testing.T) {
+	dir := t.TempDir()
+	aCert, aKey, _ := writeCert(t, dir, "a", "a.test", "a.test")
+	wildCert, wildKey, _ := writeCert(t, dir, "wild", "wild", "*.b.test")
+	bCert, bKey, _ := writeCert(t, dir, "b", "x.b.test", "x.b.test")
+
+	store := NewCertStore()
+	require.NoError(t, store.Add(aCert, aKey))
+	require.NoError(t, store.Add(wildCert, wildKey))
+	require.NoError(t, store.Add(bCert, bKey))
+
+	served := func(name string) string {
+		t.Helper()
+		cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+		require.NoError(t, err)
+		return cert.Leaf.Subject.CommonName
+	}
+
+	// Test: SNI selection, exact names before wildcards, first pair by default
+	assert.Equal(t, "a.test", served("a.test"))
+	assert.Equal(t, "a.test", served("A.Test."))
+	assert.Equal(t, "x.b.test", served("x.b.test"))
+	assert.Equal(t, "wild", served("y.b.test"))
+	assert.Equal(t, "a.test", served("z.y.b.test"))
+	assert.Equal(t, "a.test", served("b.test"))
+	assert.Equal(t, "a.test", served(""))
+
+	// Test: SNI over a real handshake
+	s := NewServer()
+	s.TLSConfig = &tls.Config{GetCertificate: store.GetCertificate}
+	require.NoError(t, s.ServeTLS(0, echoTLS, "", ""))
+	defer s.Close()
+	conn, err := tls.Dial("tcp", s.Addr().String(), &tls.Config{ServerName: "y.b.test", InsecureSkipVerify: true})
+	require.NoError(t, err)
+	assert.Equal(t, "wild", conn.ConnectionState().PeerCertificates[0].Subject.CommonName)
+	conn.Close()
+
+	// Test: Files replaced on disk are picked up on the next handshake
+	store.checkInterval = 0
+	writeCert(t, dir, "a", "a2.test", "a.test")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(aCert, future, future))
+	assert.Equal(t, "a2.test", served("a.test"))
+
+	// Test: A broken replacement keeps the previous certificate
+	require.NoError(t, os.WriteFile(aCert, []byte("not a certificate"), 0o600))
+	future = future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(aCert, future, future))
+	assert.Equal(t, "a2.test", served("a.test"))
+	assert.Error(t, store.Reload())
+
+	// Test: Reload forces a reload before the interval is up
+	store.checkInterval = time.Hour
+	writeCert(t, dir, "a", "a3.test", "a.test")
+	require.NoError(t, store.Reload())
+	assert.Equal(t, "a3.test", served("a.test"))
+
+	// Test: An empty store has nothing to serve
+	_, err = NewCertStore().GetCertificate(&tls.ClientHelloInfo{})
+	assert.ErrorIs(t, err, ErrNoCertificate)
+}